@@ -24,20 +24,41 @@ ease of use.
 package session
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"errors"
+	"io"
+	"net"
 	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
+	"golang.org/x/net/publicsuffix"
 )
 
 //Config is the set of configuration settings for working with templates.
 type Config struct {
-	//Domain is the domain to serve the cookie under. The default is ".".
+	//Domain is the domain to serve the cookie under. The default is ".". Set this to
+	//DomainAuto to derive the domain from each request's host instead, which allows the
+	//cookie to be shared across subdomains of whatever registrable domain the request
+	//was made to (ex.: a request to app.example.com sets the domain to example.com).
 	Domain string
 
+	//Domains is an optional list of domains the cookie can be served under. For each
+	//request, the domain that best matches the request's host (longest suffix match) is
+	//used. If no domain matches, Domain is used. This allows serving the same app on
+	//multiple domains (ex.: example.com and example.org) from one config.
+	Domains []string
+
 	//Path is the path off the domain to serve the cookie under. The default is "/"
 	//so that the cookie is served on any path for the domain.
 	Path string
@@ -54,14 +75,45 @@ type Config struct {
 	//The default value is false since we want to support HTTP requests as well.
 	Secure bool
 
+	//AutoSecure sets the Secure attribute of the cookie per request, based on if the request
+	//was made over HTTPS, rather than using the Secure field. A request is treated as HTTPS
+	//if it arrived over TLS or has an "X-Forwarded-Proto: https" header, as set by most
+	//reverse proxies; only use this if clients cannot reach your app without going through
+	//such a proxy since the header can be set by clients too. Cookies with SameSite=None are
+	//always Secure. The default is false.
+	AutoSecure bool
+
+	//RejectDowngrade marks sessions saved over HTTPS as such and causes GetSession to
+	//return ErrInsecureTransport if a marked session is then sent over plain HTTP, which
+	//may mean the connection was downgraded (SSL stripping) or a proxy is misconfigured.
+	//HTTPS is detected the same as for AutoSecure. Sessions read from the
+	//FallbackCookieNames or ReadCookieName are checked too, and Destroy still expires a
+	//rejected cookie. The default is false.
+	RejectDowngrade bool
+
 	//SameSite sets the SameSite value for the cookie to reduce leaking information during
 	//requests. This is a privacy setting. The default is http.SameSiteStrictMode.
 	SameSite http.SameSite
 
+	//SameSiteUACompat omits the SameSite attribute, rather than setting SameSite=None, for
+	//browsers known to mishandle SameSite=None cookies such as iOS 12 and Chrome 51 to 66.
+	//This only applies when SameSite is http.SameSiteNoneMode. See session_useragent.go
+	//for the list of browsers. The default is false.
+	SameSiteUACompat bool
+
 	//CookieName is the name of the cookie used for storing session data. The default is
 	//"session_cookie".
 	CookieName string
 
+	//ReadCookieName and WriteCookieName allow migrating the session to a new cookie. When
+	//WriteCookieName is set it replaces CookieName, so sessions are saved under it. When
+	//ReadCookieName is set, and the request does not have a cookie under the written name,
+	//the session is read from ReadCookieName instead and the old cookie is expired the next
+	//time the session is saved. This works the same as FallbackCookieNames but keeps the
+	//old and new names explicit so a migration can be reversed by swapping them.
+	ReadCookieName  string
+	WriteCookieName string
+
 	//AuthKey is a 64 character long string used for authenticating the cookie stored value.
 	//If this is not provided, a random value is assigned upon app start up.
 	AuthKey string
@@ -71,8 +123,215 @@ type Config struct {
 	//stored value unusable by anthing (i.e: client side scripts) other than your app.
 	EncryptKey string
 
+	//DisableRandomKeyFallback causes Init to return ErrMissingKey if no AuthKey or
+	//EncryptKey is provided, rather than generating random keys. Random keys are lost when
+	//your app restarts, logging out all users, and aren't shared between instances of your
+	//app so this is useful to catch keys missing from your config. The default is false.
+	DisableRandomKeyFallback bool
+
+	//AuthKeyBytes is a 64 byte long key used for authenticating the cookie stored value.
+	//This is an alternative to AuthKey for when your key is provided as raw bytes, for
+	//example from a KMS, and takes precedence over AuthKey when provided.
+	AuthKeyBytes []byte
+
+	//EncryptKeyBytes is a 16, 24, or 32 byte long key used for encrypting the cookie
+	//stored value. This is an alternative to EncryptKey for when your key is provided as
+	//raw bytes and takes precedence over EncryptKey when provided.
+	EncryptKeyBytes []byte
+
+	//Priority sets the Priority attribute on the cookie, one of "Low", "Medium", or "High".
+	//Some browsers use this to decide which cookies to evict first when storage is limited.
+	//This is set on every cookie this package writes, including the chunk, CSRF,
+	//fingerprint, fallback, and companion cookies, so related cookies are evicted together.
+	//The default is blank which means the attribute is not set. This attribute is not
+	//supported by net/http so it is appended to the Set-Cookie header manually.
+	Priority string
+
+	//Encoding is the base64 alphabet cookie values are encoded with, either "URLSafe" or
+	//"Standard". gorilla/securecookie always uses URL safe base64, which uses '-' and '_'
+	//rather than '+' and '/'. "Standard" is useful when an external consumer of the cookie
+	//expects standard base64. The default is blank which means "URLSafe". See
+	//session_encoding.go for details.
+	Encoding string
+
+	//RejectWeakKeys causes validation to fail with ErrWeakKey when a provided AuthKey or
+	//EncryptKey is obviously low-entropy, such as a single repeated character or a short
+	//repeated pattern. This is meant to catch placeholder keys accidentally being used in
+	//production. Randomly generated keys are not checked. The default is false.
+	RejectWeakKeys bool
+
+	//FallbackCookieNames is a list of previously used cookie names. If a request does not
+	//have a cookie under CookieName, a cookie under each of these names is decoded, using
+	//the same keys, and the first one that decodes successfully is used as the session.
+	//The session is stored under CookieName, and the old cookie is expired, the next time
+	//the session is saved. This allows changing CookieName without logging users out.
+	FallbackCookieNames []string
+
+	//RejectNewSessions causes GetSession, and therefore every func that uses it, to return
+	//ErrNoSession rather than a new session when the request does not have a valid session
+	//cookie. This is useful for APIs where every request must be authenticated, so handlers
+	//don't need to check IsNew. Note that this means sessions cannot be created with this
+	//config, they must be issued by another config, or app, using the same keys and
+	//CookieName. The default is false.
+	RejectNewSessions bool
+
+	//Defaults are values populated in new sessions when they are retrieved, for example a
+	//default locale or theme, so that handlers don't need to handle these keys missing.
+	//Values in existing sessions are never overwritten. Defaults are written to the cookie
+	//the first time the session is saved.
+	Defaults map[string]string
+
+	//SkipUnchanged stops the session cookie from being written when the session's values
+	//are the same as the values in the cookie the request carried. This reduces bandwidth
+	//for read-heavy apps by not sending an identical Set-Cookie header on each response.
+	//Extend, SaveWithLifetime, and Destroy always write the cookie since they change the
+	//cookie's expiration. The default is false.
+	SkipUnchanged bool
+
+	//IDGenerator is an optional func used to generate an identifier for new sessions, for
+	//example when you want to use your own ID scheme such as ULIDs. The identifier is
+	//stored when a new session is retrieved and is returned by SessionIdentifier. Use
+	//GetSessionW to write it to the cookie immediately, otherwise it is written the next
+	//time the session is saved. This is separate from the integer ID AddSessionID stores.
+	IDGenerator func() string
+
+	//AllowChunking allows sessions that are too large for a single cookie to be split
+	//across multiple cookies rather than failing to save. See session_chunk.go for
+	//details. The default is false.
+	AllowChunking bool
+
+	//CompressMinBytes enables gzip compression of session data that is larger than this
+	//many bytes before being encrypted. Smaller sessions are not compressed since the gzip
+	//overhead can make them larger. Each cookie records if it was compressed so both are
+	//decoded. See session_compress.go for details. The default is 0, no compression.
+	CompressMinBytes int
+
+	//Audience scopes sessions to a specific service when multiple services share the same
+	//keys. The audience is stored in the session when it is saved and verified when it is
+	//retrieved, returning ErrWrongAudience if the session was issued for a different, or
+	//no, audience. This stops a cookie issued by one service from being used with another.
+	//Sessions read from the FallbackCookieNames or ReadCookieName are checked too. Destroy
+	//still expires a rejected cookie.
+	Audience string
+
+	//NormalizeKeys lowercases keys in AddValue, GetValue, and GetValues so that keys are
+	//case insensitive (ex.: "Token" and "token" are the same key). Note that this changes
+	//the keys values are stored under, so values stored before this was enabled with keys
+	//that aren't lowercase will not be found. The default is false.
+	NormalizeKeys bool
+
+	//ValueEncoder and ValueDecoder are optional funcs used to transform values before they
+	//are stored and after they are retrieved, for example to encrypt especially sensitive
+	//values separately from the cookie's own encryption. The encoder is called by AddValue
+	//and the decoder is called by GetValue and GetValues, and the helpers built on these
+	//funcs, with the key the value is stored under. Other funcs, such as GetAllValues,
+	//return values as stored. The default is nil, values are stored as is.
+	ValueEncoder func(key, value string) (string, error)
+	ValueDecoder func(key, value string) (string, error)
+
+	//MaxValueBytes is the longest value, in bytes, that can be stored with AddValue. This
+	//catches mistakes like storing a whole file in a session at the point of the mistake
+	//rather than when the cookie fails to save. The default is 0, no limit.
+	MaxValueBytes int
+
+	//AutoExtend causes GetValueW to extend the expiration of existing sessions each time a
+	//value is read, so that active users stay logged in without calling Extend. This only
+	//applies to GetValueW since the other getters do not have access to the response. The
+	//default is false.
+	AutoExtend bool
+
+	//ResetIncompatibleData causes sessions that return ErrIncompatibleData to be treated as
+	//new, empty, sessions instead of returning the error. The old cookie is overwritten the
+	//next time the session is saved. This is useful when the types of stored values change
+	//between deploys and logging some users out is acceptable. The default is false.
+	ResetIncompatibleData bool
+
+	//OnDecodeError is an optional func called when GetSession fails to decode the request's
+	//session cookie, for example because it was tampered with or was issued with different
+	//keys. Only the length of the cookie's value is provided, never the value itself, so
+	//this can be used to log or count decode failures without logging a possibly malicious
+	//value. This is called once per request for each cookie that fails to decode, including
+	//chunks and cookies under the ReadCookieName or FallbackCookieNames.
+	OnDecodeError func(r *http.Request, cookieLen int, err error)
+
+	//MigrateFrom is an optional func used to read session data from a previous session
+	//scheme, for example a plain JSON cookie, when a request does not have a valid session
+	//cookie. If values are returned, the session is populated with them and will be
+	//stored in the encrypted cookie the next time the session is saved. This allows
+	//migrating users to this package without logging everyone out.
+	MigrateFrom func(r *http.Request) (map[string]string, error)
+
+	//IdleTimeout and AbsoluteTimeout are how long a session can be inactive and how long a
+	//session can exist, respectively, before the user is logged out. GetSession returns
+	//ErrTimedOut for a session that has exceeded either timeout, and TimeoutStatus reports
+	//the time remaining. Activity is recorded by InactivityGuard, which uses IdleTimeout if
+	//no idle duration is provided; without it the idle time is measured from when the
+	//session was created. The default is 0, no timeout.
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+
+	//CodeAttempts and CodeLifetime are how many times a code stored with StoreCodeHash can
+	//be checked with VerifyCode and how long the code is valid for, respectively. The
+	//defaults are 5 attempts and 10 minutes. The attempts limit only protects against brute
+	//force guessing when Overflow is set, otherwise a client can replay an earlier cookie to
+	//restore attempts.
+	CodeAttempts int
+	CodeLifetime time.Duration
+
+	//Overflow is an optional server side store for values that are too large to keep in the
+	//cookie. Values larger than OverflowMinBytes are stored in Overflow, keyed by an ID
+	//this package generates, rather than in the cookie, and are read back transparently by
+	//GetValue and the other funcs that read values. See session_overflow.go for details.
+	//The default is nil, all values are stored in the cookie.
+	Overflow         OverflowStore
+	OverflowMinBytes int
+
+	//InactivityRedirect is the URL a user is redirected to when InactivityGuard expires
+	//their session. If this is blank, InactivityStatus is returned instead.
+	InactivityRedirect string
+
+	//InactivityStatus is the HTTP status code returned when InactivityGuard expires a
+	//session and no InactivityRedirect is set. The default is http.StatusUnauthorized.
+	InactivityStatus int
+
+	//OnConflict is an optional func called when a session is saved but the request carried
+	//an older version of the session than the latest version saved, meaning changes made
+	//by another request will be overwritten. The session being saved is provided so that
+	//you can re-merge values as needed. Returning an error stops the session from being
+	//saved. Setting this enables version tracking, see session_version.go for details.
+	OnConflict func(r *http.Request, s *sessions.Session) error
+
+	//MaxTrackedVersions is the number of sessions versions are tracked for when OnConflict
+	//is set. Once exceeded, the session saved least recently is no longer tracked so memory
+	//use is bounded. The default is 10000.
+	MaxTrackedVersions int
+
 	//store stores the session data
 	store *sessions.CookieStore
+
+	//versions tracks the latest version saved for each session when OnConflict is set.
+	versions *versionTracker
+
+	//generatedAuthKey and generatedEncryptKey are the keys generated by validate when no
+	//keys were provided. These are used by Equal to ignore generated keys.
+	generatedAuthKey    string
+	generatedEncryptKey string
+
+	//sso is set when the config was created with NewSSOConfig so that the SSO settings are
+	//validated together.
+	sso bool
+
+	//companions are the names of cookies registered with RegisterCompanionCookie that are
+	//expired by Destroy.
+	companions []string
+
+	//hardened is set when Harden is called so that the hardened settings are validated
+	//together.
+	hardened bool
+
+	//sealed is set when Init is called and prevents the package level setters from
+	//modifying the config since changes would not be reflected in the store.
+	sealed bool
 }
 
 //defaults
@@ -87,8 +346,27 @@ const (
 
 	authKeyLength    = 64
 	encryptKeyLength = 32
+
+	//browserMaxAge is the longest lifetime browsers allow for a cookie, longer lifetimes
+	//are reduced to this by browsers.
+	browserMaxAge = 400 * 24 * time.Hour
+
+	//hardenedMaxAge is the MaxAge set by Harden.
+	hardenedMaxAge = 15 * time.Minute
+
+	//cookie name prefixes browsers enforce extra requirements for.
+	cookiePrefixHost   = "__Host-"
+	cookiePrefixSecure = "__Secure-"
+
+	//keys used in TestConfig(), never use these in production
+	testAuthKey    = "test-only-auth-key-do-not-use-in-production-test-only-auth-key-x"
+	testEncryptKey = "test-only-encrypt-key-not-secure"
 )
 
+//DomainAuto is a special value for the Domain field that causes the cookie domain to
+//be derived from the host of each request using the public suffix list.
+const DomainAuto = "auto"
+
 //errors
 var (
 	//ErrAuthKeyWrongSize is returned when user provided an AuthKey value that isn't 64 characters.
@@ -102,12 +380,246 @@ var (
 
 	//ErrKeyNotFound is returned when a desired key is not found in the session.
 	ErrKeyNotFound = errors.New("session: key not found in session data")
+
+	//ErrInvalidPath is returned when user provided a Path value that doesn't start with a "/"
+	//or contains invalid characters.
+	ErrInvalidPath = errors.New("session: path is invalid, must start with / and not contain control characters or semicolons")
+
+	//ErrInvalidPriority is returned when user provided a Priority value that isn't supported.
+	ErrInvalidPriority = errors.New("session: priority is invalid, must be Low, Medium, or High")
+
+	//ErrInvalidEncoding is returned when user provided an Encoding value that isn't supported.
+	ErrInvalidEncoding = errors.New("session: encoding is invalid, must be URLSafe or Standard")
+
+	//ErrAlreadyInitialized is returned by InitOnce when it has already been called, and by
+	//the package level Init after InitOnce was called.
+	ErrAlreadyInitialized = errors.New("session: package level config has already been initialized")
+
+	//ErrHeadersAlreadySent is returned when a session is saved after the response headers
+	//were written, meaning the session cookie could not be set. This is only detected
+	//when HeadersSentMiddleware or SecureHeadersMiddleware is used.
+	ErrHeadersAlreadySent = errors.New("session: response headers already written, session cookie cannot be set")
+
+	//ErrWeakKey is returned when RejectWeakKeys is set and a provided key is low-entropy.
+	ErrWeakKey = errors.New("session: auth or encrypt key is weak, use a random value")
+
+	//ErrWrongType is returned when a key exists in the session but its value is not of the
+	//expected type.
+	ErrWrongType = errors.New("session: value stored for key is not of the expected type")
+
+	//ErrSessionExpired is returned when a value that should have been stored in a session,
+	//such as a CSRF token, is checked against a new session. This typically means the
+	//session expired.
+	ErrSessionExpired = errors.New("session: session expired or does not exist")
+
+	//ErrNoSession is returned when an existing session is required but the request does not
+	//have one.
+	ErrNoSession = errors.New("session: no existing session")
+
+	//ErrTokenExpired is returned when the token stored in the session has expired.
+	ErrTokenExpired = errors.New("session: token has expired")
+
+	//ErrNoCookie is returned when a response or request does not have the session cookie.
+	ErrNoCookie = errors.New("session: session cookie not found")
+
+	//ErrReservedKey is returned when a user tries to set a value for a key this package uses
+	//for its own bookkeeping.
+	ErrReservedKey = errors.New("session: key is reserved for internal use")
+
+	//ErrWrongAudience is returned when a session was issued for a different Audience.
+	ErrWrongAudience = errors.New("session: session was issued for a different audience")
+
+	//ErrCSRFMismatch is returned when a provided CSRF token does not match the stored token.
+	ErrCSRFMismatch = errors.New("session: csrf token does not match")
+
+	//ErrUnsupportedField is returned when a struct passed to AddStruct or GetStruct has a
+	//tagged field of a type that cannot be stored as a string.
+	ErrUnsupportedField = errors.New("session: struct field type is not supported")
+
+	//ErrInvalidJSON is returned when a value being stored as JSON is not valid JSON.
+	ErrInvalidJSON = errors.New("session: value is not valid json")
+
+	//ErrInvalidSSOConfig is returned when a config created with NewSSOConfig has been
+	//modified so that the session cannot be shared across subdomains.
+	ErrInvalidSSOConfig = errors.New("session: sso config is invalid, domain must be a parent domain with a leading dot, SameSite must be Lax, and cookie must be Secure and HttpOnly")
+
+	//ErrValueTooLarge is returned when a value being stored is longer than MaxValueBytes.
+	ErrValueTooLarge = errors.New("session: value is too large")
+
+	//ErrInvalidValue is returned when a value being stored is not valid UTF-8, which
+	//typically means binary data was passed as a string by mistake.
+	ErrInvalidValue = errors.New("session: value is not valid utf-8")
+
+	//ErrIncompatibleData is returned when a session cookie is authentic but its data could
+	//not be decoded, typically because the type of a stored value changed between deploys.
+	ErrIncompatibleData = errors.New("session: session data is incompatible and could not be decoded")
+
+	//ErrTampered is returned by GetValueStrict when the session cookie failed authentication,
+	//meaning it was modified or was not issued with this config's AuthKey.
+	ErrTampered = errors.New("session: session cookie failed authentication and may have been tampered with")
+
+	//ErrNotInitialized is returned when a func that requires the session store is called
+	//before Init.
+	ErrNotInitialized = errors.New("session: config has not been initialized, call Init first")
+
+	//ErrSelfTestFailed is returned by SelfTest when a value did not decode to the value that
+	//was encoded.
+	ErrSelfTestFailed = errors.New("session: self test failed, decoded value does not match encoded value")
+
+	//ErrInsecureTransport is returned when RejectDowngrade is set and a session that was
+	//issued over HTTPS is sent with a plain HTTP request.
+	ErrInsecureTransport = errors.New("session: session issued over https was sent over http")
+
+	//ErrMissingKey is returned when DisableRandomKeyFallback is set and an AuthKey or
+	//EncryptKey was not provided.
+	ErrMissingKey = errors.New("session: auth key and encrypt key must be provided")
+
+	//ErrInvalidCookiePrefix is returned when CookieName starts with "__Host-" or "__Secure-"
+	//but the cookie's other settings do not meet the prefix's requirements, in which case
+	//browsers would reject the cookie.
+	ErrInvalidCookiePrefix = errors.New("session: cookie name prefix requirements not met, __Secure- requires Secure and __Host- also requires Path / and no Domain")
+
+	//ErrInvalidHardenedConfig is returned when a config that Harden was called on has been
+	//modified to settings weaker than the hardened settings.
+	ErrInvalidHardenedConfig = errors.New("session: hardened config is invalid, must be Secure, HttpOnly, SameSite Strict, and not generate random keys")
+
+	//ErrInvalidEnum is returned when a value is not one of the allowed values.
+	ErrInvalidEnum = errors.New("session: value is not one of the allowed values")
+
+	//ErrTimedOut is returned by GetSession and TimeoutStatus when the session has been
+	//inactive for longer than the IdleTimeout or has existed for longer than the
+	//AbsoluteTimeout.
+	ErrTimedOut = errors.New("session: session has exceeded its idle or absolute timeout")
+
+	//ErrReplayDetected is returned by CheckFingerprint when the session's fingerprint does
+	//not match the fingerprint cookie, meaning the session cookie may have been copied.
+	ErrReplayDetected = errors.New("session: session fingerprint mismatch, session cookie may have been copied")
+
+	//ErrInvalidReturnURL is returned when a return URL is not a local path.
+	ErrInvalidReturnURL = errors.New("session: return url must be a local path")
+
+	//ErrCodeExpired is returned by VerifyCode when the stored code has expired or has been
+	//checked too many times. The code is removed from the session.
+	ErrCodeExpired = errors.New("session: code has expired or too many attempts were made")
 )
 
+//keyPrefixInternal is prepended to every key this package stores in sessions for its own
+//bookkeeping so that these keys do not collide with keys used by apps. Any key starting
+//with this prefix is reserved.
+const keyPrefixInternal = "_session."
+
+//internalKeys are keys this package stores in sessions for its own bookkeeping. These
+//are not considered user values.
+var internalKeys = map[string]bool{
+	keyCSRFToken:      true,
+	keyLastActivity:   true,
+	keyCreatedAt:      true,
+	keyVersion:        true,
+	keyVersionID:      true,
+	keyLifetime:       true,
+	keyTokenExpiresAt: true,
+	keyAudience:       true,
+	keyIDIssuedAt:     true,
+	keyIssuedSecure:   true,
+	keyFingerprint:    true,
+	keyReturnURL:      true,
+	keyOverflowID:     true,
+	keyIdentifier:     true,
+}
+
+//keyLifetime is the key in the session a per-session lifetime is stored under, overriding
+//the config's MaxAge. The lifetime is stored as a number of seconds.
+const keyLifetime = keyPrefixInternal + "lifetime"
+
+//keyAudience is the key in the session the Audience the session was issued for is stored
+//under.
+const keyAudience = keyPrefixInternal + "audience"
+
+//keyIssuedSecure is the key in the session used to mark a session as saved over HTTPS
+//when RejectDowngrade is set.
+const keyIssuedSecure = keyPrefixInternal + "issued_secure"
+
+//keyCreatedAt is the key in the session the time the session was first saved is stored
+//under. The time is stored as a unix timestamp.
+const keyCreatedAt = keyPrefixInternal + "created_at"
+
+//keyPrefixUntil is prepended to a key to store the time the value set with AddValueUntil
+//expires. The time is stored as a unix timestamp.
+const keyPrefixUntil = keyPrefixInternal + "until:"
+
+//isInternalKey returns true if the key is used by this package for its own bookkeeping.
+func isInternalKey(key interface{}) bool {
+	k, ok := key.(string)
+	if !ok {
+		return false
+	}
+
+	return strings.HasPrefix(k, keyPrefixInternal)
+}
+
+//ReservedKeys returns the keys this package stores in sessions for its own bookkeeping.
+//These keys cannot be set using AddValue. Keys beginning with any of the prefixes in
+//ReservedKeyPrefixes() are also reserved.
+func ReservedKeys() []string {
+	keys := make([]string, 0, len(internalKeys))
+	for k := range internalKeys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//ReservedKeyPrefixes returns the prefixes of keys this package stores in sessions for its
+//own bookkeeping. Every key this package uses, including those returned by ReservedKeys(),
+//starts with one of these prefixes.
+func ReservedKeyPrefixes() []string {
+	return []string{keyPrefixInternal}
+}
+
 //config is the package level saved config. This stores your config when you want to store
 //it for global use. It is populated when you use one of the Default...Config() funcs.
 var config Config
 
+//initializedOnce is set once InitOnce has successfully initialized the package level config
+//so that InitOnce, Init, and DefaultConfig cannot replace it afterwards. initMu guards it.
+var (
+	initMu          sync.Mutex
+	initializedOnce bool
+)
+
+//isInitializedOnce returns true if InitOnce has successfully initialized the package level
+//config.
+func isInitializedOnce() bool {
+	initMu.Lock()
+	defer initMu.Unlock()
+	return initializedOnce
+}
+
+//nowFunc returns the current time. This is used everywhere the current time is needed so
+//that tests can use a fake clock to check expiration and timeout logic without sleeping.
+var nowFunc = time.Now
+
+//randSource is the source of randomness used when generating keys and tokens. This
+//defaults to crypto/rand but can be changed using SetRandSource().
+var randSource io.Reader = rand.Reader
+
+//SetRandSource sets the source of randomness used when generating keys and tokens. This
+//is useful for reproducible tests or when a specific source is required for compliance
+//reasons. Providing nil resets the source to crypto/rand.
+func SetRandSource(r io.Reader) {
+	if r == nil {
+		r = rand.Reader
+	}
+	randSource = r
+}
+
+//randomBytes returns n bytes read from the configured source of randomness.
+func randomBytes(n int) (b []byte, err error) {
+	b = make([]byte, n)
+	_, err = io.ReadFull(randSource, b)
+	return
+}
+
 //NewConfig returns a config for managing your session setup with some defaults set.
 func NewConfig() *Config {
 	return &Config{
@@ -122,14 +634,107 @@ func NewConfig() *Config {
 }
 
 //DefaultConfig initializes the package level config with some defaults set. This wraps
-//NewConfig() and saves the config to the package.
+//NewConfig() and saves the config to the package. This panics if InitOnce was called since
+//replacing the package level config would invalidate every existing session.
 func DefaultConfig() {
+	if isInitializedOnce() {
+		panic("session: cannot call DefaultConfig after InitOnce")
+	}
+
 	cfg := NewConfig()
 	config = *cfg
 }
 
-//validate handles validation of a provided config.
-func (c *Config) validate() (err error) {
+//TestConfig returns a config with fixed, clearly fake, auth and encrypt keys set. This is
+//useful for writing tests against sessions where cookies need to be decoded across
+//requests or app restarts since NewConfig() results in random keys being generated.
+//
+//This must never be used in production since the keys are publicly known!
+func TestConfig() *Config {
+	cfg := NewConfig()
+	cfg.AuthKey = testAuthKey
+	cfg.EncryptKey = testEncryptKey
+	cfg.MaxAge = defaultMaxAge
+	return cfg
+}
+
+//NewSSOConfig returns a config for sharing a session across all subdomains of parentDomain,
+//for example single sign on across *.example.com. The domain is set with a leading dot,
+//SameSite is set to Lax so the cookie is sent when navigating between subdomains and
+//returning from an identity provider, and the cookie is Secure and HttpOnly. The same
+//keys and CookieName must be used by every subdomain's app. Init returns ErrInvalidSSOConfig
+//if these settings are changed to a combination that will not work across subdomains.
+func NewSSOConfig(parentDomain, authKey, encryptKey string) *Config {
+	cfg := NewConfig()
+	cfg.Domain = "." + strings.TrimPrefix(strings.TrimSpace(parentDomain), ".")
+	cfg.SameSite = http.SameSiteLaxMode
+	cfg.Secure = true
+	cfg.HTTPOnly = true
+	cfg.AuthKey = authKey
+	cfg.EncryptKey = encryptKey
+	cfg.sso = true
+	return cfg
+}
+
+//validateSSO checks that a config created with NewSSOConfig still has settings that allow
+//sharing the session across subdomains.
+func (c *Config) validateSSO() (err error) {
+	domain := strings.TrimPrefix(c.Domain, ".")
+	if !strings.HasPrefix(c.Domain, ".") || !strings.Contains(domain, ".") || len(c.Domains) > 0 {
+		return ErrInvalidSSOConfig
+	}
+
+	if c.SameSite != http.SameSiteLaxMode || !c.Secure || !c.HTTPOnly {
+		return ErrInvalidSSOConfig
+	}
+
+	return
+}
+
+//Harden applies a preset of strict cookie settings: Secure, HttpOnly, SameSite Strict, a
+//short MaxAge, a "__Host-" prefixed CookieName so browsers only accept the cookie over
+//HTTPS from your exact host, and DisableRandomKeyFallback so keys must be provided. Call
+//this before Init. Init returns ErrInvalidHardenedConfig if these settings are weakened
+//afterwards. Note that the "__Host-" prefix requires that no Domain is set so this cannot
+//be combined with DomainAuto, Domains, or sharing the cookie across subdomains.
+func (c *Config) Harden() {
+	c.Secure = true
+	c.HTTPOnly = true
+	c.SameSite = http.SameSiteStrictMode
+	c.MaxAge = hardenedMaxAge
+	c.Domain = defaultDomain
+	c.Domains = nil
+	c.Path = defaultPath
+	if !strings.HasPrefix(c.CookieName, cookiePrefixHost) {
+		c.CookieName = cookiePrefixHost + c.CookieName
+	}
+	c.DisableRandomKeyFallback = true
+	c.hardened = true
+}
+
+//Harden applies a preset of strict cookie settings to the default package level config.
+func Harden() {
+	checkSealed("Harden")
+	config.Harden()
+}
+
+//validCookiePrefix checks that a config meets the requirements browsers enforce for cookie
+//names with the "__Secure-" or "__Host-" prefixes. The default domain, ".", results in no
+//Domain attribute being set.
+func validCookiePrefix(c *Config) bool {
+	switch {
+	case strings.HasPrefix(c.CookieName, cookiePrefixHost):
+		return c.Secure && c.Path == "/" && c.Domain == defaultDomain && len(c.Domains) == 0
+	case strings.HasPrefix(c.CookieName, cookiePrefixSecure):
+		return c.Secure
+	}
+
+	return true
+}
+
+//applyDefaults sets default values for fields that were left blank or set to an invalid
+//value that can be safely replaced.
+func (c *Config) applyDefaults() {
 	if strings.TrimSpace(c.Domain) == "" {
 		c.Domain = defaultDomain
 	}
@@ -138,29 +743,111 @@ func (c *Config) validate() (err error) {
 		c.Path = defaultPath
 	}
 
+	//min and max taken from http\cookie from standard lib.
+	if c.SameSite < 1 || c.SameSite > 4 {
+		c.SameSite = defaultSameSite
+	}
+}
+
+//validate handles validation of a provided config.
+func (c *Config) validate() (err error) {
+	c.applyDefaults()
+
+	if c.WriteCookieName != "" {
+		c.CookieName = c.WriteCookieName
+	}
+
+	if !validPath(c.Path) {
+		return ErrInvalidPath
+	}
+
 	if c.MaxAge < 1*time.Second {
 		return ErrMaxAgeTooShort
 	}
 
-	//min and max taken from http\cookie from standard lib.
-	if c.SameSite < 1 || c.SameSite > 4 {
-		c.SameSite = defaultSameSite
+	if c.sso {
+		err = c.validateSSO()
+		if err != nil {
+			return
+		}
+	}
+
+	if !validCookiePrefix(c) {
+		return ErrInvalidCookiePrefix
+	}
+
+	if c.hardened && (!c.Secure || !c.HTTPOnly || c.SameSite != http.SameSiteStrictMode || !c.DisableRandomKeyFallback) {
+		return ErrInvalidHardenedConfig
+	}
+
+	switch c.Priority {
+	case "", "Low", "Medium", "High":
+	default:
+		return ErrInvalidPriority
+	}
+
+	switch c.Encoding {
+	case "", encodingURLSafe, encodingStandard:
+	default:
+		return ErrInvalidEncoding
 	}
 
 	//if auth and encrypt keys were not provided, generate values
 	//switch is just cleaner than if/elseif/else in.
-	switch len(c.AuthKey) {
-	case 0:
-		c.AuthKey = string(securecookie.GenerateRandomKey(authKeyLength))
-	case authKeyLength:
+	switch {
+	case len(c.AuthKeyBytes) > 0:
+		if len(c.AuthKeyBytes) != authKeyLength {
+			return ErrAuthKeyWrongSize
+		}
+		if c.RejectWeakKeys && isWeakKey(string(c.AuthKeyBytes)) {
+			return ErrWeakKey
+		}
+	case len(c.AuthKey) == 0:
+		if c.DisableRandomKeyFallback {
+			return ErrMissingKey
+		}
+
+		var key []byte
+		key, err = randomBytes(authKeyLength)
+		if err != nil {
+			return
+		}
+		c.AuthKey = string(key)
+		c.generatedAuthKey = c.AuthKey
+	case len(c.AuthKey) == authKeyLength:
+		if c.RejectWeakKeys && isWeakKey(c.AuthKey) {
+			return ErrWeakKey
+		}
 	default:
 		return ErrAuthKeyWrongSize
 	}
 
-	switch len(c.EncryptKey) {
-	case 0:
-		c.EncryptKey = string(securecookie.GenerateRandomKey(encryptKeyLength))
-	case encryptKeyLength:
+	switch {
+	case len(c.EncryptKeyBytes) > 0:
+		switch len(c.EncryptKeyBytes) {
+		case 16, 24, encryptKeyLength:
+		default:
+			return ErrEncyptKeyWrongSize
+		}
+		if c.RejectWeakKeys && isWeakKey(string(c.EncryptKeyBytes)) {
+			return ErrWeakKey
+		}
+	case len(c.EncryptKey) == 0:
+		if c.DisableRandomKeyFallback {
+			return ErrMissingKey
+		}
+
+		var key []byte
+		key, err = randomBytes(encryptKeyLength)
+		if err != nil {
+			return
+		}
+		c.EncryptKey = string(key)
+		c.generatedEncryptKey = c.EncryptKey
+	case len(c.EncryptKey) == encryptKeyLength:
+		if c.RejectWeakKeys && isWeakKey(c.EncryptKey) {
+			return ErrWeakKey
+		}
 	default:
 		return ErrEncyptKeyWrongSize
 	}
@@ -168,6 +855,135 @@ func (c *Config) validate() (err error) {
 	return
 }
 
+//Warnings returns descriptions of settings that are valid but likely won't work as expected,
+//for example a MaxAge longer than browsers allow. Unlike validate, these don't stop Init
+//from succeeding. Log these at startup to catch misunderstandings about your config.
+func (c *Config) Warnings() (warnings []string) {
+	if c.MaxAge > browserMaxAge {
+		warnings = append(warnings, "session: MaxAge is longer than 400 days, browsers will limit the cookie's lifetime to 400 days")
+	}
+
+	return
+}
+
+//Warnings returns descriptions of settings that likely won't work as expected using the
+//default package level config.
+func Warnings() (warnings []string) {
+	return config.Warnings()
+}
+
+//ActiveFeatures returns labels for the optional features enabled in the config, in the order
+//the fields are defined in Config, for example to log at startup or show on a debug page.
+//Labels are the field names, with the value appended for fields where the value matters,
+//such as "CompressMinBytes=1024". Keys are never included. Features enabled by Init, such
+//as generated keys, are only included once Init has been called.
+func (c *Config) ActiveFeatures() (features []string) {
+	optional := []struct {
+		label   string
+		enabled bool
+	}{
+		{"Domains", len(c.Domains) > 0},
+		{"AutoSecure", c.AutoSecure},
+		{"RejectDowngrade", c.RejectDowngrade},
+		{"SameSiteUACompat", c.SameSiteUACompat},
+		{"ReadCookieName=" + c.ReadCookieName, c.ReadCookieName != ""},
+		{"WriteCookieName=" + c.WriteCookieName, c.WriteCookieName != ""},
+		{"GeneratedKeys", c.generatedAuthKey != "" || c.generatedEncryptKey != ""},
+		{"DisableRandomKeyFallback", c.DisableRandomKeyFallback},
+		{"Priority=" + c.Priority, c.Priority != ""},
+		{"Encoding=" + c.Encoding, c.Encoding == encodingStandard},
+		{"RejectWeakKeys", c.RejectWeakKeys},
+		{"FallbackCookieNames", len(c.FallbackCookieNames) > 0},
+		{"RejectNewSessions", c.RejectNewSessions},
+		{"Defaults", len(c.Defaults) > 0},
+		{"SkipUnchanged", c.SkipUnchanged},
+		{"IDGenerator", c.IDGenerator != nil},
+		{"AllowChunking", c.AllowChunking},
+		{"CompressMinBytes=" + strconv.Itoa(c.CompressMinBytes), c.CompressMinBytes > 0},
+		{"Audience=" + c.Audience, c.Audience != ""},
+		{"NormalizeKeys", c.NormalizeKeys},
+		{"ValueEncoder", c.ValueEncoder != nil},
+		{"ValueDecoder", c.ValueDecoder != nil},
+		{"MaxValueBytes=" + strconv.Itoa(c.MaxValueBytes), c.MaxValueBytes > 0},
+		{"AutoExtend", c.AutoExtend},
+		{"ResetIncompatibleData", c.ResetIncompatibleData},
+		{"OnDecodeError", c.OnDecodeError != nil},
+		{"MigrateFrom", c.MigrateFrom != nil},
+		{"IdleTimeout=" + c.IdleTimeout.String(), c.IdleTimeout > 0},
+		{"AbsoluteTimeout=" + c.AbsoluteTimeout.String(), c.AbsoluteTimeout > 0},
+		{"Overflow", c.Overflow != nil},
+		{"OnConflict", c.OnConflict != nil},
+		{"SSO", c.sso},
+		{"Hardened", c.hardened},
+		{"CompanionCookies", len(c.companions) > 0},
+	}
+
+	for _, f := range optional {
+		if f.enabled {
+			features = append(features, f.label)
+		}
+	}
+
+	return
+}
+
+//ActiveFeatures returns labels for the optional features enabled using the default package
+//level config.
+func ActiveFeatures() (features []string) {
+	return config.ActiveFeatures()
+}
+
+//validPath checks if a cookie path is valid. A path must start with a "/" and cannot
+//contain control characters or semicolons, otherwise browsers will reject the cookie.
+//The invalid characters are taken from http\cookie from standard lib.
+func validPath(path string) bool {
+	if !strings.HasPrefix(path, "/") {
+		return false
+	}
+
+	for i := 0; i < len(path); i++ {
+		b := path[i]
+		if b < 0x20 || b == 0x7f || b == ';' {
+			return false
+		}
+	}
+
+	return true
+}
+
+//minDistinctKeyBytes is the fewest number of different bytes a key can be made up of
+//before it is considered weak. This is low enough to not reject hex encoded keys.
+const minDistinctKeyBytes = 8
+
+//isWeakKey performs a simple estimate of whether or not a key is low-entropy. A key is
+//weak if it is made up of very few distinct bytes or is a short pattern repeated over
+//and over (ex.: "asdfasdf...").
+func isWeakKey(key string) bool {
+	distinct := make(map[byte]struct{})
+	for i := 0; i < len(key); i++ {
+		distinct[key[i]] = struct{}{}
+	}
+	if len(distinct) < minDistinctKeyBytes {
+		return true
+	}
+
+	//check if the key is a repetition of a pattern up to a quarter of the key's length
+	for period := 1; period <= len(key)/4; period++ {
+		repeats := true
+		for i := period; i < len(key); i++ {
+			if key[i] != key[i-period] {
+				repeats = false
+				break
+			}
+		}
+		if repeats {
+			return true
+		}
+	}
+
+	return false
+}
+
 //getOptions returns the options for setting up the session store. This is a helper func
 //to clean up code in Init() and Extend().
 func (c *Config) getOptions() *sessions.Options {
@@ -181,179 +997,1802 @@ func (c *Config) getOptions() *sessions.Options {
 	}
 }
 
-//Init initializes the session store for the given config.
-func (c *Config) Init() (err error) {
-	//validate the config
-	err = c.validate()
-	if err != nil {
-		return
+//effectiveMaxAge returns the MaxAge, in seconds, a session's cookies are written with. This
+//is the per-session lifetime if one was set with SaveWithLifetime, or MaxAge otherwise. If
+//the token's expiration was set with AddTokenWithExpiry, the cookie expires when the token
+//does and -1 is returned if the token has already expired.
+func (c *Config) effectiveMaxAge(s *sessions.Session) (maxAge int) {
+	maxAge = int(c.MaxAge.Seconds())
+	if v, exists := s.Values[keyLifetime].(string); exists {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			maxAge = seconds
+		}
+	}
+
+	if v, exists := s.Values[keyTokenExpiresAt].(string); exists {
+		if unix, err := strconv.ParseInt(v, 10, 64); err == nil {
+			maxAge = int(time.Unix(unix, 0).Sub(nowFunc()).Seconds())
+			if maxAge <= 0 {
+				maxAge = -1
+			}
+		}
 	}
 
-	//initialize the session
-	c.store = sessions.NewCookieStore(
-		[]byte(c.AuthKey),
-		[]byte(c.EncryptKey),
-	)
-	c.store.Options = c.getOptions()
 	return
 }
 
-//Init initializes the session using the defaul package level config.
-func Init() (err error) {
-	return config.Init()
-}
+//applyAutoSecure sets the Secure attribute of the options based on if the request was made
+//over HTTPS, if AutoSecure is set.
+func (c *Config) applyAutoSecure(r *http.Request, opts *sessions.Options) {
+	if !c.AutoSecure {
+		return
+	}
 
-//GetConfig returns the current state of the package level config.
-func GetConfig() (c *Config) {
-	return &config
+	opts.Secure = isHTTPS(r) || opts.SameSite == http.SameSiteNoneMode
 }
 
-//GetSession returns an existing session for a request or a new session if none existed. The
-//field IsNew of the returned sessions.Session will be true if session was just created.
-func (c *Config) GetSession(r *http.Request) (*sessions.Session, error) {
-	return c.store.Get(r, c.CookieName)
+//isHTTPS returns true if the request arrived over TLS or has an "X-Forwarded-Proto: https"
+//header.
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
 }
 
-//GetSession returns the session using the default package level config.
-func GetSession(r *http.Request) (*sessions.Session, error) {
-	return config.GetSession(r)
-}
+//domainFor returns the cookie domain to use for a request. If Domains is provided, the
+//longest domain matching the request's host is used. Otherwise, this is simply the Domain
+//field unless DomainAuto is used, in which case the registrable domain is looked up from
+//the request's host. If a registrable domain cannot be determined, for example when the
+//host is an IP address or localhost, a blank domain is returned so that a host-only
+//cookie is set.
+func (c *Config) domainFor(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	var match string
+	for _, d := range c.Domains {
+		bare := strings.ToLower(strings.TrimPrefix(d, "."))
+		if (host == bare || strings.HasSuffix(host, "."+bare)) && len(bare) > len(strings.TrimPrefix(match, ".")) {
+			match = d
+		}
+	}
+	if match != "" {
+		return match
+	}
 
-//Destroy delete a session for a request. This is typically used when you log a user out.
-func (c *Config) Destroy(w http.ResponseWriter, r *http.Request) (err error) {
-	s, err := c.GetSession(r)
-	if err != nil {
-		return
+	if c.Domain != DomainAuto {
+		return c.Domain
 	}
 
-	s.Options = c.getOptions()
-	s.Options.MaxAge = -1 //setting MaxAge to a negative value marks it as expired immediately
+	if net.ParseIP(host) != nil {
+		return ""
+	}
 
-	err = s.Save(r, w)
-	return
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return ""
+	}
+
+	return domain
 }
 
-//Destroy deletes a session using the default package level config.
-func Destroy(w http.ResponseWriter, r *http.Request) (err error) {
-	return config.Destroy(w, r)
+//save saves the session to the response, applying any options that depend on the
+//request. This should be used instead of calling Save on the session directly.
+func (c *Config) save(w http.ResponseWriter, r *http.Request, s *sessions.Session) error {
+	return c.write(w, r, s, false)
 }
 
-//Extend extends the expiration of a session and cookie. This is typically used for keeping
-//a used logged in by reseting the expiration each time a user visits a page.
-func (c *Config) Extend(w http.ResponseWriter, r *http.Request) (err error) {
-	s, err := c.GetSession(r)
-	if err != nil {
-		return
+//write handles saving the session to the response. Force is used when the cookie must be
+//written even if the session's values are unchanged, for example when extending the
+//cookie's expiration, and is only relevant when SkipUnchanged is set.
+func (c *Config) write(w http.ResponseWriter, r *http.Request, s *sessions.Session, force bool) error {
+	if c.SkipUnchanged && !force && c.unchanged(r, s) {
+		return nil
 	}
 
-	//each time we get the options, the new expiration date of the cookie is calculated
-	//from the MaxAge.
-	s.Options = c.getOptions()
+	if headersSent(w) {
+		return ErrHeadersAlreadySent
+	}
 
-	err = s.Save(r, w)
-	return
-}
+	if _, exists := s.Values[keyCreatedAt]; s.IsNew && !exists {
+		s.Values[keyCreatedAt] = strconv.FormatInt(nowFunc().Unix(), 10)
+	}
 
-//Extend handles expiration for sessions using the package level config.
-func Extend(w http.ResponseWriter, r *http.Request) (err error) {
-	return config.Extend(w, r)
-}
+	if c.Audience != "" {
+		s.Values[keyAudience] = c.Audience
+	}
 
-//AddValue adds a key-value pair to a session.
-func (c *Config) AddValue(w http.ResponseWriter, r *http.Request, key, value string) (err error) {
-	s, err := c.GetSession(r)
+	if c.RejectDowngrade && isHTTPS(r) {
+		s.Values[keyIssuedSecure] = "true"
+	}
+
+	if c.OnConflict != nil && s.Options.MaxAge >= 0 {
+		err := c.checkVersion(r, s)
+		if err != nil {
+			return err
+		}
+	}
+
+	//use the per-session lifetime and token expiration, unless the session is being destroyed
+	if s.Options.MaxAge >= 0 {
+		s.Options.MaxAge = c.effectiveMaxAge(s)
+	}
+
+	s.Options.Domain = c.domainFor(r)
+	c.applyAutoSecure(r, s.Options)
+	c.applySameSiteCompat(r, s.Options)
+
+	var err error
+	if c.AllowChunking {
+		err = c.writeChunked(w, r, s)
+	} else {
+		err = s.Save(r, w)
+		if err == nil && c.Priority != "" {
+			appendCookieAttribute(w, c.CookieName, "Priority="+c.Priority)
+		}
+	}
 	if err != nil {
-		return
+		return err
 	}
 
-	s.Values[key] = value
+	c.expireFallbacks(w, r, s)
 
-	err = s.Save(r, w)
-	return
+	return nil
 }
 
-//AddValue adds a key-value pair to a session using the default package level config.
-func AddValue(w http.ResponseWriter, r *http.Request, key, value string) (err error) {
-	return config.AddValue(w, r, key, value)
+//unchanged returns true if the session's values are the same as the values in the cookie
+//the request carried. If the request did not carry a cookie, the session is unchanged if
+//it has no values.
+func (c *Config) unchanged(r *http.Request, s *sessions.Session) bool {
+	received := make(map[interface{}]interface{})
+	if value, err := c.cookieValue(r); err == nil {
+		err := securecookie.DecodeMulti(s.Name(), value, &received, c.store.Codecs...)
+		if err != nil {
+			return false
+		}
+	}
+
+	return reflect.DeepEqual(received, s.Values)
 }
 
-//GetValue retrieves the value stored for a key in the session.
-func (c *Config) GetValue(r *http.Request, key string) (value string, err error) {
+//WillWriteCookie reports if saving the session in its current state, for example with
+//AddValue or Save, would write a Set-Cookie header. This is always true unless
+//SkipUnchanged is set, in which case it is true only if the session's values differ from
+//the cookie the request carried. Extend, SaveWithLifetime, Destroy, and other funcs that
+//change the cookie's expiration always write the cookie regardless.
+func (c *Config) WillWriteCookie(r *http.Request) (will bool, err error) {
 	s, err := c.GetSession(r)
 	if err != nil {
 		return
 	}
 
-	value, exists := s.Values[key].(string)
-	if !exists {
-		return "", ErrKeyNotFound
-	}
+	return !c.SkipUnchanged || !c.unchanged(r, s), nil
+}
 
-	return
+//WillWriteCookie reports if saving the session would write a Set-Cookie header using the
+//default package level config.
+func WillWriteCookie(r *http.Request) (will bool, err error) {
+	return config.WillWriteCookie(r)
 }
 
-//GetValue retrieves a value for a key in the session using the default package level config.
-func GetValue(r *http.Request, key string) (value string, err error) {
-	return config.GetValue(r, key)
+//setCookie sets a cookie on the response with the Priority, if one is set. This is used for
+//every cookie this package writes other than the session cookie saved by gorilla/sessions.
+func (c *Config) setCookie(w http.ResponseWriter, cookie *http.Cookie) {
+	http.SetCookie(w, cookie)
+	if c.Priority != "" {
+		appendCookieAttribute(w, cookie.Name, "Priority="+c.Priority)
+	}
 }
 
-//GetAllValues retrieves all key value pairs stored in the session.
-func (c *Config) GetAllValues(r *http.Request) (kv map[string]string, err error) {
-	s, err := c.GetSession(r)
-	if err != nil {
-		return
+//appendCookieAttribute adds an attribute to the most recently set Set-Cookie header for
+//the given cookie name. This is used for attributes that net/http doesn't support.
+func appendCookieAttribute(w http.ResponseWriter, name, attribute string) {
+	headers := w.Header()["Set-Cookie"]
+	for i := len(headers) - 1; i >= 0; i-- {
+		if strings.HasPrefix(headers[i], name+"=") {
+			headers[i] += "; " + attribute
+			return
+		}
+	}
+}
+
+//keys returns the auth and encrypt keys as bytes, preferring the raw byte keys when they
+//were provided.
+func (c *Config) keys() (authKey, encryptKey []byte) {
+	authKey = []byte(c.AuthKey)
+	if len(c.AuthKeyBytes) > 0 {
+		authKey = c.AuthKeyBytes
 	}
 
-	//convert the keys and values to strings since that is the type we use when adding values
-	//to the session and the type we use when returning the value for a specific key. just for
-	//consistency.
-	kv = make(map[string]string)
-	for k, v := range s.Values {
-		ks := k.(string)
-		vs := v.(string)
-		kv[ks] = vs
+	encryptKey = []byte(c.EncryptKey)
+	if len(c.EncryptKeyBytes) > 0 {
+		encryptKey = c.EncryptKeyBytes
 	}
 
 	return
 }
 
-//Secure sets the Secure field on the package level config.
-func Secure(yes bool) {
-	config.Secure = yes
+//EffectiveOptions returns the options the session cookie will be set with after any
+//defaults have been applied. This is useful for debugging why a cookie isn't being set
+//by a browser. Note that the Domain may be changed per request if DomainAuto or Domains
+//is used.
+func (c *Config) EffectiveOptions() *sessions.Options {
+	cfg := *c
+	cfg.applyDefaults()
+	return cfg.getOptions()
 }
 
-//HTTPOnly sets the HTTPOnly field on the package level config.
+//Init initializes the session store for the given config.
+func (c *Config) Init() (err error) {
+	//validate the config
+	err = c.validate()
+	if err != nil {
+		return
+	}
+
+	//initialize the session. only one key pair is used, so the store has a single codec and
+	//cookies are never decoded by trying multiple keys.
+	authKey, encryptKey := c.keys()
+	c.store = sessions.NewCookieStore(authKey, encryptKey)
+	c.store.Options = c.getOptions()
+	for _, codec := range c.store.Codecs {
+		sc, ok := codec.(*securecookie.SecureCookie)
+		if !ok {
+			continue
+		}
+
+		if c.AllowChunking {
+			//length is checked when splitting into chunks instead
+			sc.MaxLength(0)
+		}
+		if c.CompressMinBytes > 0 {
+			sc.SetSerializer(compressSerializer{minBytes: c.CompressMinBytes})
+		}
+	}
+	if c.Encoding == encodingStandard {
+		for i, codec := range c.store.Codecs {
+			c.store.Codecs[i] = standardEncodingCodec{codec}
+		}
+	}
+	c.versions = newVersionTracker(c.MaxTrackedVersions)
+	c.Seal()
+	return
+}
+
+//Seal marks the config as sealed so that the package level setters (Domain(), Secure(),
+//etc.) panic instead of modifying the config. This is called automatically by Init since
+//changes made to the config after Init would not be reflected in the session store.
+func (c *Config) Seal() {
+	c.sealed = true
+}
+
+//Unseal allows the package level setters to modify the config again. You will most likely
+//need to call Init again after modifying the config for the changes to take effect.
+func (c *Config) Unseal() {
+	c.sealed = false
+}
+
+//Unseal allows the package level config to be modified again by the setters.
+func Unseal() {
+	config.Unseal()
+}
+
+//checkSealed panics if the package level config is sealed. This is used in the package
+//level setters to prevent modifying a config that has already been initialized.
+func checkSealed(field string) {
+	if config.sealed {
+		panic("session: cannot set " + field + " after Init, call Unseal first and then Init again")
+	}
+}
+
+//Init initializes the session using the defaul package level config. ErrAlreadyInitialized
+//is returned if InitOnce was called.
+func Init() (err error) {
+	if isInitializedOnce() {
+		return ErrAlreadyInitialized
+	}
+
+	return config.Init()
+}
+
+//InitOnce saves the provided config as the package level config and initializes it, only
+//the first time it is called. Later calls do not modify the package level config and
+//return ErrAlreadyInitialized. This is useful when an app has multiple init paths since
+//initializing the package level config again, with different or random keys, would
+//invalidate every existing session. If Init returns an error, the package level config is
+//left unchanged and InitOnce can be called again. Changes made to cfg after calling this are
+//not reflected in the package level config. Once this succeeds, the package level Init
+//returns ErrAlreadyInitialized and DefaultConfig panics so the config cannot be replaced.
+func InitOnce(cfg *Config) (err error) {
+	initMu.Lock()
+	defer initMu.Unlock()
+
+	if initializedOnce {
+		return ErrAlreadyInitialized
+	}
+
+	saved := config
+	config = *cfg
+	err = config.Init()
+	if err != nil {
+		config = saved
+		return
+	}
+
+	initializedOnce = true
+	return
+}
+
+//Close releases any resources held by the session store. The cookie store does not hold
+//any resources so this is a no-op, but this should still be called (typically deferred
+//after Init) so that switching to a store that does hold resources (files, network
+//connections) later on doesn't require changes to your app's shutdown code.
+func (c *Config) Close() (err error) {
+	return
+}
+
+//Close releases any resources held by the default package level config's session store.
+func Close() (err error) {
+	return config.Close()
+}
+
+//SelfTest encodes a known session value using the session store's keys and decodes it back,
+//returning an error if the round trip fails. Call this after Init, at startup, to make sure
+//sessions will work before serving requests.
+func (c *Config) SelfTest() (err error) {
+	if c.store == nil {
+		return ErrNotInitialized
+	}
+
+	in := map[interface{}]interface{}{"selftest": "value"}
+	encoded, err := securecookie.EncodeMulti(c.CookieName, in, c.store.Codecs...)
+	if err != nil {
+		return
+	}
+
+	out := make(map[interface{}]interface{})
+	err = securecookie.DecodeMulti(c.CookieName, encoded, &out, c.store.Codecs...)
+	if err != nil {
+		return
+	}
+
+	if !reflect.DeepEqual(in, out) {
+		return ErrSelfTestFailed
+	}
+
+	return
+}
+
+//SelfTest checks that values can be encoded and decoded using the default package level config.
+func SelfTest() (err error) {
+	return config.SelfTest()
+}
+
+//GetConfig returns the current state of the package level config.
+func GetConfig() (c *Config) {
+	return &config
+}
+
+//GetSession returns an existing session for a request or a new session if none existed. The
+//field IsNew of the returned sessions.Session will be true if session was just created.
+//If the session cookie doesn't exist, the FallbackCookieNames and then MigrateFrom are
+//used to find existing session data.
+func (c *Config) GetSession(r *http.Request) (*sessions.Session, error) {
+	s, err := c.store.Get(r, c.CookieName)
+	if s == nil {
+		//gorilla/sessions does not return a session for an invalid cookie name
+		return nil, err
+	}
+	if err != nil {
+		if cookie, cErr := r.Cookie(c.CookieName); cErr == nil {
+			c.reportDecodeError(r, c.CookieName, len(cookie.Value), err)
+		}
+	}
+
+	if err != nil && isIncompatibleData(err) {
+		if !c.ResetIncompatibleData {
+			return s, ErrIncompatibleData
+		}
+
+		//values may have been partially decoded
+		s.Values = make(map[interface{}]interface{})
+		err = nil
+	}
+	if s.IsNew && c.AllowChunking {
+		if _, cErr := r.Cookie(c.CookieName); cErr == http.ErrNoCookie && c.decodeChunks(r, s) {
+			s.IsNew = false
+			err = nil
+		}
+	}
+
+	if s.IsNew && len(c.fallbackNames()) > 0 {
+		if _, cErr := r.Cookie(c.CookieName); cErr == http.ErrNoCookie && c.decodeFallback(r, s) {
+			s.IsNew = false
+			err = nil
+		}
+	}
+
+	//values read from a cookie, under any name, were issued by this package so the values
+	//it stores when issuing the session are checked. Migrated values never hold these.
+	fromCookie := !s.IsNew
+
+	if s.IsNew && c.MigrateFrom != nil {
+		values, mErr := c.MigrateFrom(r)
+		if mErr != nil {
+			return s, mErr
+		}
+
+		if len(values) > 0 {
+			for k, v := range values {
+				if isInternalKey(k) {
+					continue
+				}
+
+				sErr := c.setValue(s, c.normalizeKey(k), v)
+				if sErr != nil {
+					return s, sErr
+				}
+			}
+
+			//the session now holds existing data so it isn't new, this also stops the
+			//migration from running again if the session is retrieved again during
+			//this request.
+			s.IsNew = false
+			err = nil
+		}
+	}
+
+	if fromCookie {
+		dErr := c.checkDecoded(r, s)
+		if rejected(dErr) {
+			return nil, dErr
+		}
+		if dErr != nil {
+			return s, dErr
+		}
+	}
+
+	if s.IsNew && c.RejectNewSessions {
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrNoSession
+	}
+
+	if s.IsNew {
+		for k, v := range c.Defaults {
+			if _, exists := s.Values[k]; exists {
+				continue
+			}
+
+			dErr := c.setValue(s, k, v)
+			if dErr != nil {
+				return s, dErr
+			}
+		}
+
+		if _, exists := s.Values[keyIdentifier]; c.IDGenerator != nil && !exists {
+			s.Values[keyIdentifier] = c.IDGenerator()
+		}
+	}
+
+	return s, err
+}
+
+//checkDecoded checks the values decoded from a session cookie: the Audience, RejectDowngrade,
+//and the timeouts. Values set with AddValueUntil that have expired are removed. r may be nil
+//when the cookie was not read from a request, the transport is unknown then so RejectDowngrade
+//is not checked. The session must not be used if ErrWrongAudience or ErrInsecureTransport is
+//returned.
+func (c *Config) checkDecoded(r *http.Request, s *sessions.Session) (err error) {
+	if c.Audience != "" {
+		if aud, _ := s.Values[keyAudience].(string); aud != c.Audience {
+			return ErrWrongAudience
+		}
+	}
+
+	if r != nil && c.RejectDowngrade && !isHTTPS(r) {
+		if v, _ := s.Values[keyIssuedSecure].(string); v == "true" {
+			return ErrInsecureTransport
+		}
+	}
+
+	if c.IdleTimeout > 0 || c.AbsoluteTimeout > 0 {
+		_, _, err = c.timeoutRemaining(s)
+		if err != nil {
+			return
+		}
+	}
+
+	return c.purgeExpiredValues(s)
+}
+
+//decodeFallback tries to decode the session from a cookie stored under one of the fallback
+//cookie names, populating the session's values from the first one that can be decoded.
+//True is returned if a fallback cookie was decoded.
+func (c *Config) decodeFallback(r *http.Request, s *sessions.Session) bool {
+	for _, name := range c.fallbackNames() {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			continue
+		}
+
+		values := make(map[interface{}]interface{})
+		err = securecookie.DecodeMulti(name, cookie.Value, &values, c.store.Codecs...)
+		if err != nil {
+			c.reportDecodeError(r, name, len(cookie.Value), err)
+			continue
+		}
+
+		for k, v := range values {
+			s.Values[k] = v
+		}
+		return true
+	}
+
+	return false
+}
+
+//decodeReportedKey is the key, in a request's context, of the cookie names whose decode errors
+//were already passed to OnDecodeError during the request.
+type decodeReportedKey struct{}
+
+//reportDecodeError calls OnDecodeError, if set, for a cookie that could not be decoded. Each
+//cookie name is only reported once per request since the error is cached for the request and
+//GetSession is usually called many times. The request is updated in place to remember what
+//was reported, the same as gorilla/sessions does to cache sessions for the request.
+func (c *Config) reportDecodeError(r *http.Request, name string, cookieLen int, err error) {
+	if c.OnDecodeError == nil {
+		return
+	}
+
+	reported, _ := r.Context().Value(decodeReportedKey{}).(map[string]bool)
+	if reported[name] {
+		return
+	}
+	if reported == nil {
+		reported = make(map[string]bool)
+		*r = *r.WithContext(context.WithValue(r.Context(), decodeReportedKey{}, reported))
+	}
+	reported[name] = true
+
+	c.OnDecodeError(r, cookieLen, err)
+}
+
+//fallbackNames returns the cookie names a session is read from if the request does not have
+//a cookie under CookieName, the ReadCookieName followed by the FallbackCookieNames.
+func (c *Config) fallbackNames() (names []string) {
+	if c.ReadCookieName != "" && c.ReadCookieName != c.CookieName {
+		names = append(names, c.ReadCookieName)
+	}
+
+	return append(names, c.FallbackCookieNames...)
+}
+
+//expireFallbacks expires any cookies stored under the fallback cookie names that were sent
+//with the request. This is done when the session is saved since the session is now stored
+//under the primary cookie name.
+func (c *Config) expireFallbacks(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	for _, name := range c.fallbackNames() {
+		if _, err := r.Cookie(name); err != nil {
+			continue
+		}
+
+		ops := *s.Options
+		ops.MaxAge = -1
+		c.setCookie(w, sessions.NewCookie(name, "", &ops))
+	}
+}
+
+//VerifyCookie checks if a request carries a valid, untampered, session cookie without
+//creating a new session if one does not exist. A session stored in chunks, when
+//AllowChunking is set, is reassembled and checked. If the cookie is missing, false and
+//ErrNoCookie are returned. If the cookie could not be decoded, false and the decoding
+//error are returned.
+func (c *Config) VerifyCookie(r *http.Request) (valid bool, err error) {
+	value, err := c.cookieValue(r)
+	if err != nil {
+		return false, err
+	}
+
+	values := make(map[interface{}]interface{})
+	err = securecookie.DecodeMulti(c.CookieName, value, &values, c.store.Codecs...)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+//VerifyCookie checks if a request carries a valid session cookie using the default package
+//level config.
+func VerifyCookie(r *http.Request) (valid bool, err error) {
+	return config.VerifyCookie(r)
+}
+
+//purgeExpiredValues removes values set with AddValueUntil whose until time has passed.
+func (c *Config) purgeExpiredValues(s *sessions.Session) (err error) {
+	now := nowFunc()
+	for k, v := range s.Values {
+		ks, ok := k.(string)
+		if !ok || !strings.HasPrefix(ks, keyPrefixUntil) {
+			continue
+		}
+
+		str, _ := v.(string)
+		until, pErr := strconv.ParseInt(str, 10, 64)
+		if pErr == nil && now.Unix() <= until {
+			continue
+		}
+
+		err = c.removeValue(s, strings.TrimPrefix(ks, keyPrefixUntil))
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+//isIncompatibleData returns true if an error returned when decoding a cookie happened while
+//deserializing the cookie's data, after the cookie was authenticated and decrypted. The
+//serializer's errors are wrapped again by securecookie so a decode error caused by another
+//decode error only happens during deserializing.
+func isIncompatibleData(err error) bool {
+	if multi, ok := err.(securecookie.MultiError); ok {
+		for _, e := range multi {
+			if e != nil && isIncompatibleData(e) {
+				return true
+			}
+		}
+		return false
+	}
+
+	scErr, ok := err.(securecookie.Error)
+	if !ok || !scErr.IsDecode() {
+		return false
+	}
+
+	_, ok = scErr.Cause().(securecookie.Error)
+	return ok
+}
+
+//GetSession returns the session using the default package level config.
+func GetSession(r *http.Request) (*sessions.Session, error) {
+	return config.GetSession(r)
+}
+
+//GetSessionW returns the session for a request like GetSession. If the session is new and
+//IDGenerator is set, the session is saved so that the generated identifier is written to
+//the cookie immediately rather than on the next save.
+func (c *Config) GetSessionW(w http.ResponseWriter, r *http.Request) (s *sessions.Session, err error) {
+	s, err = c.GetSession(r)
+	if err != nil || !s.IsNew || c.IDGenerator == nil {
+		return
+	}
+
+	err = c.save(w, r, s)
+	return
+}
+
+//GetSessionW returns the session for a request, saving new sessions if IDGenerator is set,
+//using the default package level config.
+func GetSessionW(w http.ResponseWriter, r *http.Request) (s *sessions.Session, err error) {
+	return config.GetSessionW(w, r)
+}
+
+//Values returns a copy of the session's decoded values and a func to save the session. The
+//map can be modified freely and then saved once, avoiding decoding the session for each
+//change, and the save goes through the same path as the other funcs so all config options
+//apply. Changes made to the map are copied to the session when save is called: keys added
+//or changed are set and keys removed from the map are removed from the session.
+//
+//String values are decoded with the ValueDecoder, including values stored in the Overflow
+//store, and string values that are added or changed are stored with the same checks as
+//AddValue. Keys this package uses for its own bookkeeping (see ReservedKeys()) are not
+//included in the map and save returns ErrReservedKey, without saving, if any are added.
+//NormalizeKeys is not applied, values of types other than strings must be registered with
+//gob, and retrieving values of the wrong type is your responsibility.
+func (c *Config) Values(r *http.Request) (values map[interface{}]interface{}, save func(w http.ResponseWriter) error, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	original := make(map[interface{}]interface{}, len(s.Values))
+	for k, v := range s.Values {
+		if _, ok := k.(string); !ok && !isInternalKey(k) {
+			original[k] = v
+		}
+	}
+	for _, k := range userKeys(s) {
+		v, _, lErr := c.lookupValue(s, k)
+		if lErr == ErrWrongType {
+			original[k] = s.Values[k]
+			continue
+		}
+		if lErr != nil {
+			return nil, nil, lErr
+		}
+		original[k] = v
+	}
+
+	values = make(map[interface{}]interface{}, len(original))
+	for k, v := range original {
+		values[k] = v
+	}
+
+	save = func(w http.ResponseWriter) error {
+		for k := range values {
+			if isInternalKey(k) {
+				return ErrReservedKey
+			}
+		}
+
+		for k := range original {
+			if _, exists := values[k]; exists {
+				continue
+			}
+
+			if ks, ok := k.(string); ok {
+				err := c.removeValue(s, ks)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			delete(s.Values, k)
+		}
+
+		for k, v := range values {
+			if old, exists := original[k]; exists && reflect.DeepEqual(old, v) {
+				continue
+			}
+
+			ks, keyOK := k.(string)
+			vs, valueOK := v.(string)
+			if keyOK && valueOK {
+				err := c.setValue(s, ks, vs)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			if keyOK {
+				err := c.deleteOverflowValue(s, ks)
+				if err != nil {
+					return err
+				}
+			}
+			s.Values[k] = v
+		}
+
+		//later saves only apply changes made since this save
+		original = make(map[interface{}]interface{}, len(values))
+		for k, v := range values {
+			original[k] = v
+		}
+
+		return c.save(w, r, s)
+	}
+
+	return values, save, nil
+}
+
+//Values returns the session's decoded values map and a func to save the session using the
+//default package level config.
+func Values(r *http.Request) (values map[interface{}]interface{}, save func(w http.ResponseWriter) error, err error) {
+	return config.Values(r)
+}
+
+//GetSessionFromCookieString decodes a session from the raw value of a session cookie, for
+//example one carried in RPC metadata rather than in an http request. The same keys and
+//checks as GetSession are used, except RejectDowngrade since the transport is unknown. The
+//session is returned with ErrTimedOut if it has timed out. Since there is no request, the
+//session cannot be saved with this package's funcs; use this for reading values only.
+func (c *Config) GetSessionFromCookieString(cookieValue string) (s *sessions.Session, err error) {
+	s = sessions.NewSession(c.store, c.CookieName)
+	opts := *c.store.Options
+	s.Options = &opts
+
+	err = securecookie.DecodeMulti(c.CookieName, cookieValue, &s.Values, c.store.Codecs...)
+	if err != nil {
+		return nil, err
+	}
+	s.IsNew = false
+
+	err = c.checkDecoded(nil, s)
+	if rejected(err) {
+		return nil, err
+	}
+
+	return
+}
+
+//GetSessionFromCookieString decodes a session from the raw value of a session cookie using
+//the default package level config.
+func GetSessionFromCookieString(cookieValue string) (s *sessions.Session, err error) {
+	return config.GetSessionFromCookieString(cookieValue)
+}
+
+//SameSession reports if two requests carry the same session, for example to debug why a
+//user got a new session after a redirect. The session IDs stored in each session are
+//compared if both have one, otherwise the hashes of the cookie values are compared which
+//means a session that was saved again between the requests is reported as different.
+//ErrNoCookie is returned if either request does not have a session cookie and a decoding
+//error is returned if either cookie is invalid.
+func (c *Config) SameSession(a, b *http.Request) (same bool, err error) {
+	idA, err := c.sessionIdentity(a)
+	if err != nil {
+		return
+	}
+
+	idB, err := c.sessionIdentity(b)
+	if err != nil {
+		return
+	}
+
+	return idA == idB, nil
+}
+
+//SameSession reports if two requests carry the same session using the default package level
+//config.
+func SameSession(a, b *http.Request) (same bool, err error) {
+	return config.SameSession(a, b)
+}
+
+//sessionIdentity returns a value identifying the session a request carries for use in
+//SameSession, the session ID if one is stored or the hash of the cookie value otherwise.
+func (c *Config) sessionIdentity(r *http.Request) (id string, err error) {
+	value, err := c.cookieValue(r)
+	if err != nil {
+		return
+	}
+
+	values := make(map[interface{}]interface{})
+	err = securecookie.DecodeMulti(c.CookieName, value, &values, c.store.Codecs...)
+	if err != nil {
+		return
+	}
+
+	if sid, exists := values[keyIdentifier].(string); exists && sid != "" {
+		return "id:" + sid, nil
+	}
+	if sid, exists := values[keySessionID].(string); exists && sid != "" {
+		return "session_id:" + sid, nil
+	}
+
+	return "hash:" + hashValue(value), nil
+}
+
+//Destroy delete a session for a request. This is typically used when you log a user out.
+//Companion cookies, such as the CSRF cookie and any registered with RegisterCompanionCookie,
+//are expired as well.
+func (c *Config) Destroy(w http.ResponseWriter, r *http.Request) (err error) {
+	s, err := c.GetSession(r)
+	if rejected(err) {
+		//the cookie was decoded but its values are not trusted, expire it anyway
+		s, err = sessions.NewSession(c.store, c.CookieName), nil
+	}
+	if err == ErrTimedOut {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+
+	s.Options = c.getOptions()
+	s.Options.MaxAge = -1 //setting MaxAge to a negative value marks it as expired immediately
+	c.forgetVersion(s)
+
+	err = c.write(w, r, s, true)
+	if err != nil {
+		return
+	}
+
+	c.expireCompanions(w, r, s)
+
+	err = c.deleteOverflow(s)
+	return
+}
+
+//rejected returns true if GetSession decoded a session cookie but refused to return the
+//session, for example since it was issued for a different Audience.
+func rejected(err error) bool {
+	return err == ErrWrongAudience || err == ErrInsecureTransport
+}
+
+//RegisterCompanionCookie adds a cookie name that Destroy will expire along with the session
+//cookie, for example a remember me cookie your app sets. The CSRF and fingerprint cookies
+//this package sets are always expired. Companion cookies are expired using the same Path
+//and Domain as the session cookie. Call this before serving requests.
+func (c *Config) RegisterCompanionCookie(name string) {
+	for _, n := range c.companions {
+		if n == name {
+			return
+		}
+	}
+
+	c.companions = append(c.companions, name)
+}
+
+//RegisterCompanionCookie adds a cookie name that Destroy will expire using the default package
+//level config.
+func RegisterCompanionCookie(name string) {
+	config.RegisterCompanionCookie(name)
+}
+
+//expireCompanions expires any companion cookies that were sent with the request.
+func (c *Config) expireCompanions(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	names := append([]string{c.csrfCookieName(), c.fingerprintCookieName()}, c.companions...)
+	for _, name := range names {
+		if _, err := r.Cookie(name); err != nil {
+			continue
+		}
+
+		ops := *s.Options
+		ops.MaxAge = -1
+		c.setCookie(w, sessions.NewCookie(name, "", &ops))
+	}
+}
+
+//Destroy deletes a session using the default package level config.
+func Destroy(w http.ResponseWriter, r *http.Request) (err error) {
+	return config.Destroy(w, r)
+}
+
+//Extend extends the expiration of a session and cookie. This is typically used for keeping
+//a used logged in by reseting the expiration each time a user visits a page. If a lifetime
+//was set for the session using SaveWithLifetime, it is used instead of MaxAge.
+func (c *Config) Extend(w http.ResponseWriter, r *http.Request) (err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	//each time we get the options, the new expiration date of the cookie is calculated
+	//from the MaxAge.
+	s.Options = c.getOptions()
+
+	err = c.write(w, r, s, true)
+	return
+}
+
+//Extend handles expiration for sessions using the package level config.
+func Extend(w http.ResponseWriter, r *http.Request) (err error) {
+	return config.Extend(w, r)
+}
+
+//ExtendExisting extends the expiration of a session like Extend, but only if the request
+//carried an existing session. If the session is new, nothing is saved and ErrNoSession
+//is returned. This prevents issuing empty session cookies to anonymous visitors, such as
+//crawlers, when extending sessions on every request.
+func (c *Config) ExtendExisting(w http.ResponseWriter, r *http.Request) (err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	if s.IsNew {
+		return ErrNoSession
+	}
+
+	return c.Extend(w, r)
+}
+
+//ExtendExisting extends an existing session using the package level config.
+func ExtendExisting(w http.ResponseWriter, r *http.Request) (err error) {
+	return config.ExtendExisting(w, r)
+}
+
+//ReissueOptions saves an existing session's values with the config's current options,
+//upgrading the attributes of the cookie (Secure, SameSite, etc.) in place. This is useful
+//for rolling out a change to the cookie's attributes to active users on their next
+//request rather than waiting for their cookies to expire. ErrNoSession is returned if
+//the request did not carry an existing session.
+func (c *Config) ReissueOptions(w http.ResponseWriter, r *http.Request) (err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	if s.IsNew {
+		return ErrNoSession
+	}
+
+	s.Options = c.getOptions()
+
+	err = c.write(w, r, s, true)
+	return
+}
+
+//ReissueOptions saves an existing session with the current options using the package level config.
+func ReissueOptions(w http.ResponseWriter, r *http.Request) (err error) {
+	return config.ReissueOptions(w, r)
+}
+
+//SaveWithSameSite saves the session using a different SameSite value than the config's
+//for just this response. This is useful for SSO or OAuth callbacks that arrive as cross
+//site requests, where a Strict cookie would not be sent, while keeping Strict for the rest
+//of your app. If http.SameSiteNoneMode is used, the cookie is also marked Secure since
+//browsers reject SameSite=None cookies that aren't Secure.
+func (c *Config) SaveWithSameSite(w http.ResponseWriter, r *http.Request, ss http.SameSite) (err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	s.Options = c.getOptions()
+	s.Options.SameSite = ss
+	if ss == http.SameSiteNoneMode {
+		s.Options.Secure = true
+	}
+
+	err = c.write(w, r, s, true)
+	return
+}
+
+//SaveWithSameSite saves the session with a different SameSite value using the package
+//level config.
+func SaveWithSameSite(w http.ResponseWriter, r *http.Request, ss http.SameSite) (err error) {
+	return config.SaveWithSameSite(w, r, ss)
+}
+
+//SaveWithLifetime sets a lifetime for the session that is used instead of the config's
+//MaxAge, and saves the session. The lifetime is stored in the session so that subsequent
+//saves, including Extend, use it as well. This is typically used to honor a user's "keep
+//me logged in" choice.
+func (c *Config) SaveWithLifetime(w http.ResponseWriter, r *http.Request, d time.Duration) (err error) {
+	if d < 1*time.Second {
+		return ErrMaxAgeTooShort
+	}
+
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	s.Values[keyLifetime] = strconv.Itoa(int(d.Seconds()))
+	s.Options = c.getOptions()
+
+	err = c.write(w, r, s, true)
+	return
+}
+
+//SaveWithLifetime sets a per-session lifetime using the package level config.
+func SaveWithLifetime(w http.ResponseWriter, r *http.Request, d time.Duration) (err error) {
+	return config.SaveWithLifetime(w, r, d)
+}
+
+//AddValue adds a key-value pair to a session. ErrReservedKey is returned if the key is one
+//this package uses for its own bookkeeping, see ReservedKeys(). ErrValueTooLarge or
+//ErrInvalidValue is returned if the value is longer than MaxValueBytes or is not valid
+//UTF-8.
+func (c *Config) AddValue(w http.ResponseWriter, r *http.Request, key, value string) (err error) {
+	return c.addValue(w, r, key, value, time.Time{})
+}
+
+//AddValue adds a key-value pair to a session using the default package level config.
+func AddValue(w http.ResponseWriter, r *http.Request, key, value string) (err error) {
+	return config.AddValue(w, r, key, value)
+}
+
+//AddValueUntil adds a key-value pair to a session like AddValue, but the value is treated as
+//not existing once the until time has passed, for example for a promotion ending at a set
+//time. Multiple keys can share the same until time. Expired values are removed when the
+//session is retrieved and are dropped from the cookie the next time the session is saved.
+func (c *Config) AddValueUntil(w http.ResponseWriter, r *http.Request, key, value string, until time.Time) (err error) {
+	return c.addValue(w, r, key, value, until)
+}
+
+//AddValueUntil adds a key-value pair that expires at the until time to a session using the
+//default package level config.
+func AddValueUntil(w http.ResponseWriter, r *http.Request, key, value string, until time.Time) (err error) {
+	return config.AddValueUntil(w, r, key, value, until)
+}
+
+//addValue adds a key-value pair to a session, handling AddValue and AddValueUntil. If until
+//is the zero time the value does not expire, and any expiration previously set for the key
+//is removed.
+func (c *Config) addValue(w http.ResponseWriter, r *http.Request, key, value string, until time.Time) (err error) {
+	key = c.normalizeKey(key)
+	if isInternalKey(key) {
+		return ErrReservedKey
+	}
+
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	err = c.setValue(s, key, value)
+	if err != nil {
+		return
+	}
+	if !until.IsZero() {
+		s.Values[keyPrefixUntil+key] = strconv.FormatInt(until.Unix(), 10)
+	}
+
+	err = c.save(w, r, s)
+	return
+}
+
+//SwapValue stores newValue under key and returns the value previously stored, if any, with
+//a single save. This is useful for one time flags or tracking the previous page. The same
+//checks as AddValue are applied to the key and newValue. ErrWrongType is returned if the
+//previous value isn't a string, in which case nothing is stored.
+func (c *Config) SwapValue(w http.ResponseWriter, r *http.Request, key, newValue string) (oldValue string, existed bool, err error) {
+	key = c.normalizeKey(key)
+	if isInternalKey(key) {
+		return "", false, ErrReservedKey
+	}
+
+	err = c.validValue(newValue)
+	if err != nil {
+		return
+	}
+
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	oldValue, existed, err = c.lookupValue(s, key)
+	if err != nil {
+		return
+	}
+
+	err = c.setValue(s, key, newValue)
+	if err != nil {
+		return
+	}
+
+	err = c.save(w, r, s)
+	return
+}
+
+//SwapValue stores newValue under key and returns the previous value using the default package
+//level config.
+func SwapValue(w http.ResponseWriter, r *http.Request, key, newValue string) (oldValue string, existed bool, err error) {
+	return config.SwapValue(w, r, key, newValue)
+}
+
+//validValue checks that a value being stored is valid UTF-8 and isn't longer than the
+//MaxValueBytes.
+func (c *Config) validValue(value string) error {
+	if c.MaxValueBytes > 0 && len(value) > c.MaxValueBytes {
+		return ErrValueTooLarge
+	}
+
+	if !utf8.ValidString(value) {
+		return ErrInvalidValue
+	}
+
+	return nil
+}
+
+//setValue stores a user value in the session. Every func that stores user values uses this
+//so the same rules apply to each: the key cannot be reserved, the value must be valid, the
+//ValueEncoder is applied, large values are stored in the Overflow store, and any expiration
+//set with AddValueUntil is removed. The key must already be normalized.
+func (c *Config) setValue(s *sessions.Session, key, value string) (err error) {
+	if isInternalKey(key) {
+		return ErrReservedKey
+	}
+
+	err = c.validValue(value)
+	if err != nil {
+		return
+	}
+
+	if c.ValueEncoder != nil {
+		value, err = c.ValueEncoder(key, value)
+		if err != nil {
+			return
+		}
+	}
+
+	err = c.storeValue(s, key, value)
+	if err != nil {
+		return
+	}
+
+	delete(s.Values, keyPrefixUntil+key)
+	return
+}
+
+//lookupValue returns a user value from the session, reading it from the Overflow store if
+//needed and applying the ValueDecoder. Every func that reads user values uses this. Keys
+//this package uses for its own bookkeeping are never returned. ErrWrongType is returned,
+//with exists set to true, if the value stored isn't a string. The key must already be
+//normalized.
+func (c *Config) lookupValue(s *sessions.Session, key string) (value string, exists bool, err error) {
+	if isInternalKey(key) {
+		return
+	}
+
+	raw, exists := s.Values[key]
+	if exists {
+		v, ok := raw.(string)
+		if !ok {
+			return "", true, ErrWrongType
+		}
+		value = v
+	} else {
+		value, exists, err = c.overflowValue(s, key)
+		if err != nil || !exists {
+			return
+		}
+	}
+
+	if c.ValueDecoder != nil {
+		value, err = c.ValueDecoder(key, value)
+	}
+	return
+}
+
+//removeValue removes a user value from the session along with the time it expires, if it
+//was set with AddValueUntil, and its entry in the Overflow store, if it overflowed.
+func (c *Config) removeValue(s *sessions.Session, key string) error {
+	delete(s.Values, key)
+	delete(s.Values, keyPrefixUntil+key)
+	return c.deleteOverflowValue(s, key)
+}
+
+//userKeys returns the keys of the user values in the session, including values stored in
+//the Overflow store.
+func userKeys(s *sessions.Session) (keys []string) {
+	for k := range s.Values {
+		ks, ok := k.(string)
+		if ok && !isInternalKey(ks) {
+			keys = append(keys, ks)
+		}
+	}
+
+	for _, k := range overflowKeys(s) {
+		if !isInternalKey(k) {
+			keys = append(keys, k)
+		}
+	}
+
+	return
+}
+
+//userValues returns the user values stored in the session, including values stored in the
+//Overflow store, decoded with the ValueDecoder. Values that aren't strings, such as maps
+//added with AddMap, are skipped.
+func (c *Config) userValues(s *sessions.Session) (kv map[string]string, err error) {
+	kv = make(map[string]string)
+	for _, k := range userKeys(s) {
+		v, _, lErr := c.lookupValue(s, k)
+		if lErr == ErrWrongType {
+			continue
+		}
+		if lErr != nil {
+			return nil, lErr
+		}
+		kv[k] = v
+	}
+
+	return
+}
+
+//GetValue retrieves the value stored for a key in the session. ErrKeyNotFound is returned if
+//the key does not exist and ErrWrongType is returned if the value stored isn't a string.
+func (c *Config) GetValue(r *http.Request, key string) (value string, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	value, exists, err := c.lookupValue(s, c.normalizeKey(key))
+	if err != nil {
+		return
+	}
+	if !exists {
+		return "", ErrKeyNotFound
+	}
+
+	return
+}
+
+//GetValue retrieves a value for a key in the session using the default package level config.
+func GetValue(r *http.Request, key string) (value string, err error) {
+	return config.GetValue(r, key)
+}
+
+//GetValueW retrieves the value stored for a key in the session like GetValue. If
+//AutoExtend is set and the request carried an existing session, the session's expiration
+//is extended as well.
+func (c *Config) GetValueW(w http.ResponseWriter, r *http.Request, key string) (value string, err error) {
+	value, err = c.GetValue(r, key)
+	if err != nil || !c.AutoExtend {
+		return
+	}
+
+	err = c.ExtendExisting(w, r)
+	if err == ErrNoSession {
+		err = nil
+	}
+	return
+}
+
+//GetValueW retrieves a value for a key, extending the session if AutoExtend is set, using
+//the default package level config.
+func GetValueW(w http.ResponseWriter, r *http.Request, key string) (value string, err error) {
+	return config.GetValueW(w, r, key)
+}
+
+//GetValueStrict retrieves the value stored for a key in the session like GetValue, but
+//returns ErrTampered if the request's session cookie failed authentication. This allows
+//telling apart a cookie that was modified, which may be worth alerting on, from a key that
+//simply doesn't exist. Note that a cookie issued with a different AuthKey, for example
+//before keys were changed, also fails authentication.
+func (c *Config) GetValueStrict(r *http.Request, key string) (value string, err error) {
+	_, err = c.GetSession(r)
+	if err != nil {
+		if isTampered(err) {
+			return "", ErrTampered
+		}
+		return
+	}
+
+	return c.GetValue(r, key)
+}
+
+//GetValueStrict retrieves a value for a key, returning ErrTampered if the session cookie
+//failed authentication, using the default package level config.
+func GetValueStrict(r *http.Request, key string) (value string, err error) {
+	return config.GetValueStrict(r, key)
+}
+
+//isTampered returns true if an error returned when decoding a cookie was caused by the
+//cookie failing authentication or not being validly encoded.
+func isTampered(err error) bool {
+	if multi, ok := err.(securecookie.MultiError); ok {
+		for _, e := range multi {
+			if e != nil && isTampered(e) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if err == securecookie.ErrMacInvalid {
+		return true
+	}
+
+	scErr, ok := err.(securecookie.Error)
+	if !ok || !scErr.IsDecode() {
+		return false
+	}
+
+	_, ok = scErr.Cause().(base64.CorruptInputError)
+	return ok
+}
+
+//normalizeKey lowercases a key if NormalizeKeys is set.
+func (c *Config) normalizeKey(key string) string {
+	if c.NormalizeKeys {
+		return strings.ToLower(key)
+	}
+	return key
+}
+
+//GetValueFold retrieves the value stored for a key in the session, matching the key case
+//insensitively. If multiple keys match, which differ only by case, the exact match is
+//preferred otherwise any of the matching values may be returned.
+func (c *Config) GetValueFold(r *http.Request, key string) (value string, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	value, exists, err := c.lookupValue(s, key)
+	if exists {
+		return
+	}
+
+	for _, k := range userKeys(s) {
+		if !strings.EqualFold(k, key) {
+			continue
+		}
+
+		value, _, err = c.lookupValue(s, k)
+		return
+	}
+
+	return "", ErrKeyNotFound
+}
+
+//GetValueFold retrieves a value for a key, matching case insensitively, using the default
+//package level config.
+func GetValueFold(r *http.Request, key string) (value string, err error) {
+	return config.GetValueFold(r, key)
+}
+
+//GetValueAny retrieves the value of the first of the keys that exists in the session, along
+//with which key it was stored under. This is useful when renaming a key; read the new key,
+//then the old key, and migrate the value to the new key if the old key was found.
+//ErrKeyNotFound is returned if none of the keys exist and ErrWrongType is returned if the
+//value stored under the first key found isn't a string.
+func (c *Config) GetValueAny(r *http.Request, keys ...string) (value, foundKey string, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	for _, k := range keys {
+		value, exists, err := c.lookupValue(s, c.normalizeKey(k))
+		if !exists {
+			continue
+		}
+
+		return value, k, err
+	}
+
+	return "", "", ErrKeyNotFound
+}
+
+//GetValueAny retrieves the value of the first of the keys that exists using the default
+//package level config.
+func GetValueAny(r *http.Request, keys ...string) (value, foundKey string, err error) {
+	return config.GetValueAny(r, keys...)
+}
+
+//ValueEquals compares the value stored in the session for a key to an expected value in
+//constant time. This should be used rather than == when comparing a stored secret, such
+//as a token, to user input so the comparison does not leak how much of the value matched.
+//Note that the time taken still depends on whether the lengths match. ErrKeyNotFound is
+//returned if the key is not in the session.
+func (c *Config) ValueEquals(r *http.Request, key, expected string) (equal bool, err error) {
+	value, err := c.GetValue(r, key)
+	if err != nil {
+		return
+	}
+
+	equal = subtle.ConstantTimeCompare([]byte(value), []byte(expected)) == 1
+	return
+}
+
+//ValueEquals compares a stored value to an expected value in constant time using the
+//default package level config.
+func ValueEquals(r *http.Request, key, expected string) (equal bool, err error) {
+	return config.ValueEquals(r, key, expected)
+}
+
+//GetValues retrieves the values stored for multiple keys in the session. Keys that do not
+//exist in the session are omitted from the returned map rather than causing an error.
+func (c *Config) GetValues(r *http.Request, keys ...string) (kv map[string]string, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	kv = make(map[string]string, len(keys))
+	for _, k := range keys {
+		v, exists, lErr := c.lookupValue(s, c.normalizeKey(k))
+		if !exists || lErr == ErrWrongType {
+			continue
+		}
+		if lErr != nil {
+			return nil, lErr
+		}
+		kv[k] = v
+	}
+
+	return
+}
+
+//GetValues retrieves values for multiple keys in the session using the default package level config.
+func GetValues(r *http.Request, keys ...string) (kv map[string]string, err error) {
+	return config.GetValues(r, keys...)
+}
+
+//ExportValues retrieves the values for only the given keys, for example to record a few
+//values in an audit log. This is safer than GetAllValues for logging since the keys logged
+//are listed explicitly. Keys that do not exist are omitted. The token key and keys this
+//package uses for its own bookkeeping, such as the CSRF token, are never returned even if
+//requested since these are secrets that should not be logged.
+func (c *Config) ExportValues(r *http.Request, keys ...string) (kv map[string]string, err error) {
+	allowed := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if isInternalKey(c.normalizeKey(k)) || c.normalizeKey(k) == keyToken {
+			continue
+		}
+		allowed = append(allowed, k)
+	}
+
+	return c.GetValues(r, allowed...)
+}
+
+//ExportValues retrieves the values for only the given keys using the default package level
+//config.
+func ExportValues(r *http.Request, keys ...string) (kv map[string]string, err error) {
+	return config.ExportValues(r, keys...)
+}
+
+//GetAllValues retrieves all key value pairs stored in the session. Values this package stores
+//for its own bookkeeping, and values that aren't strings, are not included.
+func (c *Config) GetAllValues(r *http.Request) (kv map[string]string, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	return c.userValues(s)
+}
+
+//DeleteValuesByPrefix removes every key in the session that starts with prefix, for
+//example all "cart." keys, and saves the session once. The number of keys deleted is
+//returned. Keys this package uses for its own bookkeeping are never deleted. If no keys
+//match, the session is not saved.
+func (c *Config) DeleteValuesByPrefix(w http.ResponseWriter, r *http.Request, prefix string) (deleted int, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	for _, k := range userKeys(s) {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		err = c.removeValue(s, k)
+		if err != nil {
+			return
+		}
+		deleted++
+	}
+
+	if deleted == 0 {
+		return
+	}
+
+	err = c.save(w, r, s)
+	return
+}
+
+//DeleteValuesByPrefix removes every key starting with prefix using the default package
+//level config.
+func DeleteValuesByPrefix(w http.ResponseWriter, r *http.Request, prefix string) (deleted int, err error) {
+	return config.DeleteValuesByPrefix(w, r, prefix)
+}
+
+//CountValuesNS returns the number of keys in the session that start with the namespace ns,
+//for example the number of "cart." keys. Keys this package uses for its own bookkeeping
+//are not counted.
+func (c *Config) CountValuesNS(r *http.Request, ns string) (count int, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	for _, k := range userKeys(s) {
+		if strings.HasPrefix(k, ns) {
+			count++
+		}
+	}
+
+	return
+}
+
+//CountValuesNS returns the number of keys in the namespace ns using the default package
+//level config.
+func CountValuesNS(r *http.Request, ns string) (count int, err error) {
+	return config.CountValuesNS(r, ns)
+}
+
+//MergeFrom copies the values from source into the request's session and saves it. This is
+//useful when a user logs in after browsing anonymously to carry over values, such as a
+//cart, from the anonymous session. If overwrite is false, values already in the request's
+//session are kept when a key exists in both. Keys this package uses for its own
+//bookkeeping are never copied.
+func (c *Config) MergeFrom(w http.ResponseWriter, r *http.Request, source *sessions.Session, overwrite bool) (err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	existing := make(map[interface{}]bool)
+	for _, k := range userKeys(s) {
+		existing[k] = true
+	}
+	for k, v := range source.Values {
+		if _, ok := k.(string); ok || isInternalKey(k) {
+			continue
+		}
+
+		//keys that aren't strings can't be set with this package's funcs, copy them as is
+		if _, exists := s.Values[k]; !exists || overwrite {
+			s.Values[k] = v
+		}
+	}
+
+	for _, k := range userKeys(source) {
+		if existing[k] && !overwrite {
+			continue
+		}
+
+		v, _, lErr := c.lookupValue(source, k)
+		if lErr == ErrWrongType {
+			err = c.deleteOverflowValue(s, k)
+			if err != nil {
+				return
+			}
+			s.Values[k] = source.Values[k]
+			continue
+		}
+		if lErr != nil {
+			return lErr
+		}
+
+		err = c.setValue(s, k, v)
+		if err != nil {
+			return
+		}
+	}
+
+	err = c.save(w, r, s)
+	return
+}
+
+//MergeFrom copies the values from source into the request's session using the default
+//package level config.
+func MergeFrom(w http.ResponseWriter, r *http.Request, source *sessions.Session, overwrite bool) (err error) {
+	return config.MergeFrom(w, r, source, overwrite)
+}
+
+//GetCreatedAt returns the time the session was first saved. ErrKeyNotFound is returned if
+//the session has never been saved.
+func (c *Config) GetCreatedAt(r *http.Request) (t time.Time, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	v, exists := s.Values[keyCreatedAt].(string)
+	if !exists {
+		return t, ErrKeyNotFound
+	}
+
+	unix, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return
+	}
+
+	return time.Unix(unix, 0), nil
+}
+
+//GetCreatedAt returns the time the session was first saved using the default package level config.
+func GetCreatedAt(r *http.Request) (t time.Time, err error) {
+	return config.GetCreatedAt(r)
+}
+
+//IsEmpty returns true if the session does not have any values stored in it. Values this
+//package stores for its own bookkeeping are ignored. This is useful for deciding whether
+//to bother saving a session for an anonymous visitor.
+func (c *Config) IsEmpty(r *http.Request) (empty bool, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	return len(userKeys(s)) == 0, nil
+}
+
+//IsEmpty checks if the session has no values using the default package level config.
+func IsEmpty(r *http.Request) (empty bool, err error) {
+	return config.IsEmpty(r)
+}
+
+//EncodedSize returns the length, in bytes, of the session cookie's value if the session
+//were saved now. This is useful for checking if there is room to store more data before
+//hitting browsers' cookie size limit of about 4KB. No cookie is written.
+func (c *Config) EncodedSize(r *http.Request) (size int, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	encoded, err := securecookie.EncodeMulti(s.Name(), s.Values, c.store.Codecs...)
+	if err != nil {
+		return
+	}
+
+	return len(encoded), nil
+}
+
+//EncodedSize returns the size of the encoded session using the default package level config.
+func EncodedSize(r *http.Request) (size int, err error) {
+	return config.EncodedSize(r)
+}
+
+//GetAllValuesTyped retrieves all key value pairs stored in the session, converting each value
+//to its most likely natural type. Values that parse as integers are returned as int64,
+//values that parse as booleans are returned as bool, and everything else is returned as
+//a string. This is a best-effort conversion useful for displaying a session in an admin
+//or debug tool; use GetAllValues when you need the values exactly as stored.
+func (c *Config) GetAllValuesTyped(r *http.Request) (kv map[string]interface{}, err error) {
+	values, err := c.GetAllValues(r)
+	if err != nil {
+		return
+	}
+
+	kv = make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			kv[k] = i
+		} else if b, err := strconv.ParseBool(v); err == nil {
+			kv[k] = b
+		} else {
+			kv[k] = v
+		}
+	}
+
+	return
+}
+
+//Secure sets the Secure field on the package level config.
+func Secure(yes bool) {
+	checkSealed("Secure")
+	config.Secure = yes
+}
+
+//HTTPOnly sets the HTTPOnly field on the package level config.
 func HTTPOnly(yes bool) {
+	checkSealed("HTTPOnly")
 	config.HTTPOnly = yes
 }
 
 //Domain sets the Domain field on the package level config.
 func Domain(domain string) {
+	checkSealed("Domain")
 	config.Domain = domain
 }
 
 //Path sets the Path field on the package level config.
 func Path(path string) {
+	checkSealed("Path")
 	config.Path = path
 }
 
 //MaxAge sets the MaxAge field on the package level config.
 func MaxAge(maxAge time.Duration) {
+	checkSealed("MaxAge")
 	config.MaxAge = maxAge
 }
 
 //Keys sets the AuthKey and EncryptKey fields on the package level config.
 func Keys(authKey, encryptkey string) {
+	checkSealed("Keys")
 	config.AuthKey = authKey
 	config.EncryptKey = encryptkey
 }
 
+//KeysBytes sets the AuthKeyBytes and EncryptKeyBytes fields on the package level config.
+func KeysBytes(authKey, encryptKey []byte) {
+	checkSealed("KeysBytes")
+	config.AuthKeyBytes = authKey
+	config.EncryptKeyBytes = encryptKey
+}
+
 //CookieName sets the CookieName field on the package level config.
 func CookieName(cookieName string) {
+	checkSealed("CookieName")
 	config.CookieName = cookieName
 }
 
+//Priority sets the Priority field on the package level config.
+func Priority(priority string) {
+	checkSealed("Priority")
+	config.Priority = priority
+}
+
 //SameSite sets the SameSite field on the package level config.
 func SameSite(sameSite http.SameSite) {
+	checkSealed("SameSite")
 	config.SameSite = sameSite
 }
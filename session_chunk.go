@@ -0,0 +1,157 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines tooling for storing sessions that are too large for a single cookie
+across multiple cookies. When AllowChunking is set and the encoded session is longer than
+a single cookie can hold, the encoded value is split into chunks stored in cookies named
+with the chunk's index appended to the CookieName (ex.: session.0, session.1, ...). The
+chunks are reassembled when the session is retrieved.
+
+Keep in mind that browsers limit the total number and size of cookies per domain as well
+so chunking only goes so far; a server side store is better for very large sessions.
+*/
+
+package session
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+//maxChunkLength is the longest value stored in a single cookie when chunking. This is less
+//than the typical browser limit of 4096 bytes to leave room for the cookie's name and
+//attributes.
+const maxChunkLength = 3800
+
+//chunkName returns the name of the cookie a chunk of the session is stored in.
+func (c *Config) chunkName(i int) string {
+	return c.CookieName + "." + strconv.Itoa(i)
+}
+
+//chunkedValue returns the encoded session value reassembled from the chunk cookies the
+//request carried. False is returned if the request did not carry any chunks.
+func (c *Config) chunkedValue(r *http.Request) (value string, ok bool) {
+	var b strings.Builder
+	for i := 0; ; i++ {
+		cookie, err := r.Cookie(c.chunkName(i))
+		if err != nil {
+			break
+		}
+
+		b.WriteString(cookie.Value)
+		ok = true
+	}
+
+	return b.String(), ok
+}
+
+//isChunkName returns true if a cookie name is the name of a chunk of the session.
+func (c *Config) isChunkName(name string) bool {
+	if !strings.HasPrefix(name, c.CookieName+".") {
+		return false
+	}
+
+	_, err := strconv.Atoi(strings.TrimPrefix(name, c.CookieName+"."))
+	return err == nil
+}
+
+//cookieValue returns the encoded session value the request carried, from the cookie named
+//CookieName or, if AllowChunking is set and the request has no such cookie, reassembled
+//from the chunk cookies. ErrNoCookie is returned if the request carried neither.
+func (c *Config) cookieValue(r *http.Request) (value string, err error) {
+	cookie, err := r.Cookie(c.CookieName)
+	if err == nil {
+		return cookie.Value, nil
+	}
+
+	if c.AllowChunking {
+		if value, ok := c.chunkedValue(r); ok {
+			return value, nil
+		}
+	}
+
+	return "", ErrNoCookie
+}
+
+//decodeChunks populates the session's values from the chunk cookies the request carried.
+//True is returned if chunks were decoded. OnDecodeError is called if the chunks could not
+//be decoded.
+func (c *Config) decodeChunks(r *http.Request, s *sessions.Session) bool {
+	value, ok := c.chunkedValue(r)
+	if !ok {
+		return false
+	}
+
+	values := make(map[interface{}]interface{})
+	err := securecookie.DecodeMulti(c.CookieName, value, &values, c.store.Codecs...)
+	if err != nil {
+		c.reportDecodeError(r, c.CookieName, len(value), err)
+		return false
+	}
+
+	for k, v := range values {
+		s.Values[k] = v
+	}
+	return true
+}
+
+//writeChunked saves the session, splitting the encoded value across multiple cookies if
+//it is too long for a single cookie. Any cookies left over from how the session was
+//previously stored (the single cookie or extra chunks) are expired. Every cookie is set
+//with the Priority, if one is set.
+func (c *Config) writeChunked(w http.ResponseWriter, r *http.Request, s *sessions.Session) error {
+	expired := *s.Options
+	expired.MaxAge = -1
+
+	//destroying the session, expire every cookie it may be stored in
+	if s.Options.MaxAge < 0 {
+		c.setCookie(w, sessions.NewCookie(c.CookieName, "", &expired))
+		c.expireChunks(w, r, 0, &expired)
+		return nil
+	}
+
+	encoded, err := securecookie.EncodeMulti(c.CookieName, s.Values, c.store.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	if len(encoded) <= maxChunkLength {
+		c.setCookie(w, sessions.NewCookie(c.CookieName, encoded, s.Options))
+		c.expireChunks(w, r, 0, &expired)
+		return nil
+	}
+
+	n := 0
+	for start := 0; start < len(encoded); start += maxChunkLength {
+		end := start + maxChunkLength
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+
+		c.setCookie(w, sessions.NewCookie(c.chunkName(n), encoded[start:end], s.Options))
+		n++
+	}
+
+	if _, err := r.Cookie(c.CookieName); err == nil {
+		c.setCookie(w, sessions.NewCookie(c.CookieName, "", &expired))
+	}
+	c.expireChunks(w, r, n, &expired)
+
+	return nil
+}
+
+//expireChunks expires any chunk cookies the request carried starting at the given index.
+func (c *Config) expireChunks(w http.ResponseWriter, r *http.Request, from int, expired *sessions.Options) {
+	for i := from; ; i++ {
+		if _, err := r.Cookie(c.chunkName(i)); err != nil {
+			return
+		}
+
+		c.setCookie(w, sessions.NewCookie(c.chunkName(i), "", expired))
+	}
+}
@@ -0,0 +1,174 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestAllowChunking(t *testing.T) {
+	cfg := TestConfig()
+	cfg.AllowChunking = true
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//large session is split across cookies
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	large := strings.Repeat("abcdefghij", 800)
+	err = cfg.AddValue(w, req, "large", large)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) < 2 {
+		t.Fatal("session not chunked", len(cookies))
+		return
+	}
+
+	//chunks are reassembled
+	req = httptest.NewRequest("GET", "/", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	v, err := cfg.GetValue(req, "large")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if v != large {
+		t.Fatal("chunked value not reassembled")
+		return
+	}
+
+	//shrinking the session stores a single cookie and expires the chunks
+	s, _ := cfg.GetSession(req)
+	delete(s.Values, "large")
+	w = httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "small", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	var single bool
+	var expired int
+	for _, c := range w.Result().Cookies() {
+		if c.Name == cfg.CookieName && c.MaxAge > 0 {
+			single = true
+		}
+		if strings.HasPrefix(c.Name, cfg.CookieName+".") && c.MaxAge < 0 {
+			expired++
+		}
+	}
+	if !single || expired != len(cookies) {
+		t.Fatal("leftover chunks not expired", single, expired)
+		return
+	}
+}
+
+func TestChunkedReaders(t *testing.T) {
+	cfg := TestConfig()
+	cfg.AllowChunking = true
+	cfg.Priority = "High"
+	decodeErrors := 0
+	cfg.OnDecodeError = func(r *http.Request, cookieLen int, err error) {
+		decodeErrors++
+	}
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	chunked := func(issuedFor string) (cookies []*http.Cookie) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		err := cfg.AddValue(w, req, "large", strings.Repeat("abcdefghij", 800))
+		if err != nil {
+			t.Fatal("Error occured but should not have", err)
+		}
+		w = httptest.NewRecorder()
+		err = cfg.AddValue(w, req, "issued_for", issuedFor)
+		if err != nil {
+			t.Fatal("Error occured but should not have", err)
+		}
+
+		for _, header := range w.Header()["Set-Cookie"] {
+			if strings.HasPrefix(header, cfg.chunkName(0)+"=") && !strings.Contains(header, "Priority=High") {
+				t.Fatal("chunk should have been set with the priority", header)
+			}
+		}
+
+		for _, c := range w.Result().Cookies() {
+			if cfg.isChunkName(c.Name) && c.MaxAge > 0 {
+				cookies = append(cookies, c)
+			}
+		}
+		return
+	}
+	host := chunked("host")
+	domain := chunked("domain")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, c := range host {
+		req.AddCookie(c)
+	}
+
+	valid, err := cfg.VerifyCookie(req)
+	if err != nil || !valid {
+		t.Fatal("chunked cookie should have been valid", err)
+		return
+	}
+	same, err := cfg.SameSession(req, req)
+	if err != nil || !same {
+		t.Fatal("chunked sessions should have been the same", err)
+		return
+	}
+
+	//duplicate chunked sessions
+	req = httptest.NewRequest("GET", "/", nil)
+	for _, c := range host {
+		req.AddCookie(c)
+	}
+	for _, c := range domain {
+		req.AddCookie(c)
+	}
+	s, err := cfg.GetSessionPreferring(req, func(s *sessions.Session) bool {
+		return s.Values["issued_for"] == "domain"
+	})
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if s.Values["issued_for"] != "domain" {
+		t.Fatal("preferred chunks should have been used", s.Values["issued_for"])
+		return
+	}
+	if len(req.Cookies()) != len(domain) {
+		t.Fatal("duplicate chunks should have been removed", len(req.Cookies()))
+		return
+	}
+
+	//tampered chunks are reported
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: cfg.chunkName(0), Value: host[0].Value})
+	req.AddCookie(&http.Cookie{Name: cfg.chunkName(1), Value: "tampered"})
+	_, err = cfg.GetSession(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if decodeErrors != 1 {
+		t.Fatal("OnDecodeError should have been called", decodeErrors)
+		return
+	}
+}
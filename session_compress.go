@@ -0,0 +1,95 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines the serializer used to compress session data when CompressMinBytes is
+set. Session values are gob encoded as usual and, if the encoded data is larger than
+CompressMinBytes, it is gzipped. A flag byte is prepended to the data, prior to it being
+encrypted, recording if the data was compressed so that decoding handles both.
+
+Cookies encoded before compression was enabled do not have the flag byte, these are
+decoded as plain gob data if decoding with the flag byte fails so that enabling
+compression does not log users out.
+*/
+
+package session
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/gorilla/securecookie"
+)
+
+//flags prepended to serialized data to record if it was compressed.
+const (
+	flagUncompressed byte = 0
+	flagGzip         byte = 1
+)
+
+//compressSerializer gob encodes session data, compressing it if it is larger than
+//minBytes.
+type compressSerializer struct {
+	minBytes int
+}
+
+//Serialize encodes src, compressing it if the encoded data is larger than minBytes.
+func (cs compressSerializer) Serialize(src interface{}) (b []byte, err error) {
+	raw, err := securecookie.GobEncoder{}.Serialize(src)
+	if err != nil {
+		return
+	}
+
+	if len(raw) <= cs.minBytes {
+		return append([]byte{flagUncompressed}, raw...), nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(flagGzip)
+	zw := gzip.NewWriter(&buf)
+	_, err = zw.Write(raw)
+	if err != nil {
+		return
+	}
+	err = zw.Close()
+	if err != nil {
+		return
+	}
+
+	return buf.Bytes(), nil
+}
+
+//Deserialize decodes src into dst, decompressing it first if needed.
+func (cs compressSerializer) Deserialize(src []byte, dst interface{}) (err error) {
+	gob := securecookie.GobEncoder{}
+	if len(src) == 0 {
+		return gob.Deserialize(src, dst)
+	}
+
+	switch src[0] {
+	case flagUncompressed:
+		err = gob.Deserialize(src[1:], dst)
+	case flagGzip:
+		var zr *gzip.Reader
+		zr, err = gzip.NewReader(bytes.NewReader(src[1:]))
+		if err != nil {
+			break
+		}
+
+		var raw []byte
+		raw, err = io.ReadAll(zr)
+		if err != nil {
+			break
+		}
+		err = gob.Deserialize(raw, dst)
+	default:
+		err = gob.Deserialize(src, dst)
+	}
+
+	//data encoded before compression was enabled
+	if err != nil {
+		return gob.Deserialize(src, dst)
+	}
+	return
+}
@@ -0,0 +1,110 @@
+package session
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressMinBytes(t *testing.T) {
+	plain := TestConfig()
+	err := plain.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	compressed := TestConfig()
+	compressed.CompressMinBytes = 256
+	err = compressed.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	large := strings.Repeat("abcdefgh", 200)
+
+	//large values are compressed
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = compressed.AddValue(w, req, "large", large)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	compressedSize, err := compressed.EncodedSize(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	plainReq := httptest.NewRequest("GET", "/", nil)
+	err = plain.AddValue(httptest.NewRecorder(), plainReq, "large", large)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	plainSize, err := plain.EncodedSize(plainReq)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if compressedSize >= plainSize {
+		t.Fatal("session should have been compressed", compressedSize, plainSize)
+		return
+	}
+
+	encoded, err := compressed.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	compressed.AttachCookie(req, encoded)
+	v, err := compressed.GetValue(req, "large")
+	if err != nil || v != large {
+		t.Fatal("compressed value not decoded", err)
+		return
+	}
+
+	//small values are not compressed but still decode
+	req = httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	err = compressed.AddValue(w, req, "small", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err = compressed.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	compressed.AttachCookie(req, encoded)
+	v, err = compressed.GetValue(req, "small")
+	if err != nil || v != "value" {
+		t.Fatal("uncompressed value not decoded", err)
+		return
+	}
+
+	//cookies encoded before compression was enabled still decode
+	w = httptest.NewRecorder()
+	err = plain.AddValue(w, httptest.NewRequest("GET", "/", nil), "old", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err = plain.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	compressed.AttachCookie(req, encoded)
+	v, err = compressed.GetValue(req, "old")
+	if err != nil || v != "value" {
+		t.Fatal("old cookie not decoded", err)
+		return
+	}
+}
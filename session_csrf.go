@@ -0,0 +1,175 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines tooling for protecting against CSRF. A token is stored in the encrypted
+session and then either rendered into a page and verified on form submission using
+GenerateCSRFToken() and ValidateCSRFToken(), or also stored in a companion cookie that
+client side scripts can read, using the double-submit cookie pattern, using
+IssueCSRFCookie() and VerifyDoubleSubmit().
+
+If a session has expired, any CSRF token stored in it is lost. When a token is validated
+against a new session ErrSessionExpired is returned, instead of ErrCSRFMismatch, so that
+you can prompt the user to log in again instead of showing a misleading CSRF error.
+*/
+
+package session
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+)
+
+const (
+	//keyCSRFToken is the key in the session the CSRF token is stored under.
+	keyCSRFToken = keyPrefixInternal + "csrf_token"
+
+	//csrfCookieSuffix is appended to the CookieName to name the companion cookie.
+	csrfCookieSuffix = "_csrf"
+
+	//csrfTokenLength is the number of random bytes used in a CSRF token.
+	csrfTokenLength = 32
+)
+
+//csrfCookieName returns the name of the companion cookie the CSRF token is stored in.
+func (c *Config) csrfCookieName() string {
+	return c.CookieName + csrfCookieSuffix
+}
+
+//GenerateCSRFToken generates a new CSRF token, stores it in the session, and saves the
+//session. The token is returned so it can be rendered into a page, typically in a hidden
+//form input.
+func (c *Config) GenerateCSRFToken(w http.ResponseWriter, r *http.Request) (token string, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	b, err := randomBytes(csrfTokenLength)
+	if err != nil {
+		return
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+
+	s.Values[keyCSRFToken] = token
+	err = c.save(w, r, s)
+	return
+}
+
+//GenerateCSRFToken generates a CSRF token using the default package level config.
+func GenerateCSRFToken(w http.ResponseWriter, r *http.Request) (token string, err error) {
+	return config.GenerateCSRFToken(w, r)
+}
+
+//csrfToken returns the CSRF token stored in the session. ErrSessionExpired is returned if
+//the session is new, since any token previously issued was lost when the session expired,
+//and ErrKeyNotFound is returned if a token was never issued for the session.
+func (c *Config) csrfToken(r *http.Request) (token string, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	if s.IsNew {
+		return "", ErrSessionExpired
+	}
+
+	token, exists := s.Values[keyCSRFToken].(string)
+	if !exists {
+		return "", ErrKeyNotFound
+	}
+
+	return
+}
+
+//ValidateCSRFToken checks that the provided token, typically from a form submission,
+//matches the token stored in the session. ErrSessionExpired is returned if the session
+//has expired and ErrCSRFMismatch is returned if the token does not match.
+func (c *Config) ValidateCSRFToken(r *http.Request, token string) (err error) {
+	sessionToken, err := c.csrfToken(r)
+	if err != nil {
+		return
+	}
+
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(sessionToken)) != 1 {
+		return ErrCSRFMismatch
+	}
+
+	return
+}
+
+//ValidateCSRFToken checks a CSRF token using the default package level config.
+func ValidateCSRFToken(r *http.Request, token string) (err error) {
+	return config.ValidateCSRFToken(r, token)
+}
+
+//IssueCSRFCookie generates a new CSRF token, stores it in the session, and sets it in a
+//companion cookie that is readable by client side scripts (not HttpOnly). The token is
+//returned so it can also be rendered into a page if needed. The companion cookie expires
+//with the session cookie.
+func (c *Config) IssueCSRFCookie(w http.ResponseWriter, r *http.Request) (token string, err error) {
+	token, err = c.GenerateCSRFToken(w, r)
+	if err != nil {
+		return
+	}
+
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	ops := c.getOptions()
+	ops.MaxAge = c.effectiveMaxAge(s)
+	ops.Domain = c.domainFor(r)
+	ops.HttpOnly = false
+	c.applyAutoSecure(r, ops)
+	c.applySameSiteCompat(r, ops)
+
+	c.setCookie(w, &http.Cookie{
+		Name:     c.csrfCookieName(),
+		Value:    token,
+		Domain:   ops.Domain,
+		Path:     ops.Path,
+		MaxAge:   ops.MaxAge,
+		Secure:   ops.Secure,
+		HttpOnly: ops.HttpOnly,
+		SameSite: ops.SameSite,
+	})
+
+	return
+}
+
+//IssueCSRFCookie generates a CSRF token using the default package level config.
+func IssueCSRFCookie(w http.ResponseWriter, r *http.Request) (token string, err error) {
+	return config.IssueCSRFCookie(w, r)
+}
+
+//VerifyDoubleSubmit checks that the token provided in a header matches both the token
+//in the companion cookie and the token stored in the session. ErrSessionExpired is
+//returned if the session has expired, ErrKeyNotFound is returned if no token was ever
+//issued for the session, and ErrCSRFMismatch is returned if any of the tokens do not match.
+func (c *Config) VerifyDoubleSubmit(r *http.Request, headerToken string) (err error) {
+	sessionToken, err := c.csrfToken(r)
+	if err != nil {
+		return
+	}
+
+	cookie, err := r.Cookie(c.csrfCookieName())
+	if err != nil {
+		return ErrCSRFMismatch
+	}
+
+	if headerToken == "" ||
+		subtle.ConstantTimeCompare([]byte(headerToken), []byte(cookie.Value)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(headerToken), []byte(sessionToken)) != 1 {
+		return ErrCSRFMismatch
+	}
+
+	return
+}
+
+//VerifyDoubleSubmit checks a CSRF token using the default package level config.
+func VerifyDoubleSubmit(r *http.Request, headerToken string) (err error) {
+	return config.VerifyDoubleSubmit(r, headerToken)
+}
@@ -0,0 +1,141 @@
+package session
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDoubleSubmit(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//no session yet
+	req := httptest.NewRequest("GET", "/", nil)
+	err = cfg.VerifyDoubleSubmit(req, "token")
+	if err != ErrSessionExpired {
+		t.Fatal("ErrSessionExpired should have occured but didn't", err)
+		return
+	}
+
+	//issue token
+	w := httptest.NewRecorder()
+	token, err := cfg.IssueCSRFCookie(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if token == "" {
+		t.Fatal("No token returned")
+		return
+	}
+
+	//next request carries both cookies
+	req2 := httptest.NewRequest("POST", "/", nil)
+	found := false
+	for _, c := range w.Result().Cookies() {
+		if c.Name == cfg.csrfCookieName() {
+			found = true
+			if c.HttpOnly {
+				t.Fatal("CSRF cookie should not be HttpOnly")
+				return
+			}
+		}
+		req2.AddCookie(c)
+	}
+	if !found {
+		t.Fatal("CSRF cookie not set")
+		return
+	}
+
+	err = cfg.VerifyDoubleSubmit(req2, token)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	err = cfg.VerifyDoubleSubmit(req2, "wrong")
+	if err != ErrCSRFMismatch {
+		t.Fatal("ErrCSRFMismatch should have occured but didn't", err)
+		return
+	}
+}
+
+func TestCSRFToken(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	token, err := cfg.GenerateCSRFToken(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//form submission with the session cookie
+	encoded, _ := cfg.ExtractCookie(w)
+	req2 := httptest.NewRequest("POST", "/", nil)
+	cfg.AttachCookie(req2, encoded)
+
+	err = cfg.ValidateCSRFToken(req2, token)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	err = cfg.ValidateCSRFToken(req2, "wrong")
+	if err != ErrCSRFMismatch {
+		t.Fatal("ErrCSRFMismatch should have occured but didn't", err)
+		return
+	}
+
+	//form submission after the session expired
+	req3 := httptest.NewRequest("POST", "/", nil)
+	err = cfg.ValidateCSRFToken(req3, token)
+	if err != ErrSessionExpired {
+		t.Fatal("ErrSessionExpired should have occured but didn't", err)
+		return
+	}
+}
+
+func TestIssueCSRFCookieMaxAge(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	err = cfg.SaveWithLifetime(w, req, 30*24*time.Hour)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w = httptest.NewRecorder()
+	_, err = cfg.IssueCSRFCookie(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	maxAges := make(map[string]int)
+	for _, c := range w.Result().Cookies() {
+		maxAges[c.Name] = c.MaxAge
+	}
+	if maxAges[cfg.csrfCookieName()] != int((30*24*time.Hour).Seconds()) || maxAges[cfg.csrfCookieName()] != maxAges[cfg.CookieName] {
+		t.Fatal("csrf cookie should have used the session's lifetime", maxAges)
+		return
+	}
+}
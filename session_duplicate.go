@@ -0,0 +1,120 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines tooling for choosing between duplicate session cookies. A request can carry
+more than one cookie with the same name, for example a host-only cookie and a domain cookie
+while the Domain is being changed. Browsers send both and gorilla/sessions uses whichever
+is first in the Cookie header, which is not defined by the cookie spec for cookies with the
+same path.
+*/
+
+package session
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+//GetSessionPreferring returns the session for the request, choosing between duplicate session
+//cookies using prefer. Each duplicate cookie that can be decoded is passed to prefer, in
+//the order the cookies are in the request, and the first for which prefer returns true is
+//used. The other duplicates are removed from the request's Cookie header so that later
+//calls for this request, such as GetValue, use the same session. If the request does not
+//have duplicate cookies, or prefer does not return true for any of them, the request is not
+//modified and this is the same as GetSession. Duplicate sessions stored in chunks, when
+//AllowChunking is set, are handled the same way, see duplicates.
+//
+//This must be called before the session is retrieved any other way for the request, since
+//the session is only decoded once per request. This is typically called in middleware.
+func (c *Config) GetSessionPreferring(r *http.Request, prefer func(s *sessions.Session) bool) (*sessions.Session, error) {
+	copies := c.duplicates(r)
+	if len(copies) > 1 {
+		for _, cookies := range copies {
+			var value strings.Builder
+			for _, cookie := range cookies {
+				value.WriteString(cookie.Value)
+			}
+
+			candidate := sessions.NewSession(c.store, c.CookieName)
+			err := securecookie.DecodeMulti(c.CookieName, value.String(), &candidate.Values, c.store.Codecs...)
+			if err != nil {
+				continue
+			}
+
+			if prefer(candidate) {
+				c.keepOnly(r, cookies)
+				break
+			}
+		}
+	}
+
+	return c.GetSession(r)
+}
+
+//GetSessionPreferring returns the session for the request, choosing between duplicate session
+//cookies, using the default package level config.
+func GetSessionPreferring(r *http.Request, prefer func(s *sessions.Session) bool) (*sessions.Session, error) {
+	return config.GetSessionPreferring(r, prefer)
+}
+
+//duplicates returns each copy of the session the request carried, as the cookies the copy
+//is stored in. A copy is stored in a single cookie named CookieName unless it was stored in
+//chunks, in which case a request carrying no cookie named CookieName is checked for chunks
+//and the n-th copy is made up of the n-th cookie with each chunk's name. Copies that were
+//paired up incorrectly simply fail to decode.
+func (c *Config) duplicates(r *http.Request) (copies [][]*http.Cookie) {
+	byName := make(map[string][]*http.Cookie)
+	for _, cookie := range r.Cookies() {
+		byName[cookie.Name] = append(byName[cookie.Name], cookie)
+	}
+
+	if len(byName[c.CookieName]) > 0 {
+		for _, cookie := range byName[c.CookieName] {
+			copies = append(copies, []*http.Cookie{cookie})
+		}
+		return
+	}
+
+	if !c.AllowChunking {
+		return
+	}
+
+	for n := range byName[c.chunkName(0)] {
+		var chunks []*http.Cookie
+		for i := 0; n < len(byName[c.chunkName(i)]); i++ {
+			chunks = append(chunks, byName[c.chunkName(i)][n])
+		}
+		copies = append(copies, chunks)
+	}
+
+	return
+}
+
+//keepOnly rewrites the request's Cookie header to remove every cookie the session may be
+//stored in, under CookieName or a chunk's name, other than the cookies in keep.
+func (c *Config) keepOnly(r *http.Request, keep []*http.Cookie) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if (cookie.Name == c.CookieName || c.isChunkName(cookie.Name)) && !kept(keep, cookie) {
+			continue
+		}
+
+		r.AddCookie(cookie)
+	}
+}
+
+//kept returns true if a cookie with the same name and value as cookie is in keep.
+func kept(keep []*http.Cookie, cookie *http.Cookie) bool {
+	for _, k := range keep {
+		if k.Name == cookie.Name && k.Value == cookie.Value {
+			return true
+		}
+	}
+
+	return false
+}
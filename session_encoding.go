@@ -0,0 +1,53 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines support for encoding cookie values with standard base64 rather than the
+URL safe base64 gorilla/securecookie uses. Since securecookie does not allow changing the
+alphabet, the encoded value is translated between the two alphabets. The alphabets only
+differ by two characters and both are padded, so the translation does not change the
+length of the value. Only the outer layer of the value is translated; the inner layers
+are only ever read by securecookie.
+*/
+
+package session
+
+import (
+	"strings"
+
+	"github.com/gorilla/securecookie"
+)
+
+//values for Config.Encoding.
+const (
+	encodingURLSafe  = "URLSafe"
+	encodingStandard = "Standard"
+)
+
+//urlSafeToStandard and standardToURLSafe translate between the URL safe and standard
+//base64 alphabets.
+var (
+	urlSafeToStandard = strings.NewReplacer("-", "+", "_", "/")
+	standardToURLSafe = strings.NewReplacer("+", "-", "/", "_")
+)
+
+//standardEncodingCodec wraps a codec to encode values with standard base64 instead of URL
+//safe base64. Values encoded with either alphabet are decoded.
+type standardEncodingCodec struct {
+	securecookie.Codec
+}
+
+//Encode encodes a value using the wrapped codec and translates it to standard base64.
+func (sc standardEncodingCodec) Encode(name string, value interface{}) (encoded string, err error) {
+	encoded, err = sc.Codec.Encode(name, value)
+	if err != nil {
+		return
+	}
+
+	return urlSafeToStandard.Replace(encoded), nil
+}
+
+//Decode translates a value to URL safe base64 and decodes it using the wrapped codec.
+func (sc standardEncodingCodec) Decode(name, value string, dst interface{}) error {
+	return sc.Codec.Decode(name, standardToURLSafe.Replace(value), dst)
+}
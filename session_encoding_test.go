@@ -0,0 +1,77 @@
+package session
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEncodingStandard(t *testing.T) {
+	urlSafe := TestConfig()
+	err := urlSafe.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	standard := TestConfig()
+	standard.Encoding = "Standard"
+	err = standard.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err = standard.AddValue(w, httptest.NewRequest("GET", "/", nil), "user_id", "2554")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := standard.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if strings.ContainsAny(encoded, "-_") {
+		t.Fatal("cookie should be encoded with standard base64", encoded)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	standard.AttachCookie(req, encoded)
+	v, err := standard.GetValue(req, "user_id")
+	if err != nil || v != "2554" {
+		t.Fatal("value should have been decoded", v, err)
+		return
+	}
+
+	//cookies encoded with URL safe base64 are still decoded
+	w = httptest.NewRecorder()
+	err = urlSafe.AddValue(w, httptest.NewRequest("GET", "/", nil), "user_id", "2554")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err = urlSafe.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	standard.AttachCookie(req, encoded)
+	v, err = standard.GetValue(req, "user_id")
+	if err != nil || v != "2554" {
+		t.Fatal("value should have been decoded", v, err)
+		return
+	}
+
+	invalid := TestConfig()
+	invalid.Encoding = "base32"
+	err = invalid.Init()
+	if err != ErrInvalidEncoding {
+		t.Fatal("ErrInvalidEncoding should have occured but didn't", err)
+		return
+	}
+}
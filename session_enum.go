@@ -0,0 +1,63 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines helper functions for storing values that must be one of a fixed set of
+values, for example a user's role. The value is checked against the allowed values when
+it is stored and when it is retrieved to catch programming errors, such as a typo in a
+value or a value that is no longer allowed.
+*/
+
+package session
+
+import (
+	"net/http"
+)
+
+//AddEnum stores value under key if it is one of the allowed values, otherwise ErrInvalidEnum
+//is returned and nothing is stored.
+func (c *Config) AddEnum(w http.ResponseWriter, r *http.Request, key, value string, allowed []string) (err error) {
+	if !isAllowed(value, allowed) {
+		return ErrInvalidEnum
+	}
+
+	return c.AddValue(w, r, key, value)
+}
+
+//AddEnum stores value under key if it is one of the allowed values using the default package
+//level config.
+func AddEnum(w http.ResponseWriter, r *http.Request, key, value string, allowed []string) (err error) {
+	return config.AddEnum(w, r, key, value, allowed)
+}
+
+//GetEnum retrieves the value stored under key and checks that it is one of the allowed
+//values. ErrInvalidEnum is returned if it isn't.
+func (c *Config) GetEnum(r *http.Request, key string, allowed []string) (value string, err error) {
+	value, err = c.GetValue(r, key)
+	if err != nil {
+		return
+	}
+
+	if !isAllowed(value, allowed) {
+		return "", ErrInvalidEnum
+	}
+
+	return
+}
+
+//GetEnum retrieves the value stored under key and checks that it is one of the allowed values
+//using the default package level config.
+func GetEnum(r *http.Request, key string, allowed []string) (value string, err error) {
+	return config.GetEnum(r, key, allowed)
+}
+
+//isAllowed returns true if value is one of the allowed values.
+func isAllowed(value string, allowed []string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,126 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines a func to compare two configs. This is useful when reloading config
+to decide if Init needs to be called again to rebuild the session store.
+*/
+
+package session
+
+import (
+	"bytes"
+	"reflect"
+)
+
+//Equal returns true if the user facing fields of two configs are the same once defaults
+//are applied, including settings made by funcs such as Harden and RegisterCompanionCookie.
+//The session store and other state set by Init are ignored. Keys that were randomly
+//generated by Init are treated as not provided, so a config with generated keys equals a
+//config with no keys.
+//Func fields are equal only if they are both nil or are the same func, and Overflow stores
+//are equal only if they are both nil or are the same store.
+func (c *Config) Equal(other *Config) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+
+	a, b := *c, *other
+	for _, cfg := range []*Config{&a, &b} {
+		cfg.applyDefaults()
+		if cfg.WriteCookieName != "" {
+			cfg.CookieName = cfg.WriteCookieName
+		}
+	}
+
+	return a.Domain == b.Domain &&
+		reflect.DeepEqual(a.Domains, b.Domains) &&
+		a.Path == b.Path &&
+		a.MaxAge == b.MaxAge &&
+		a.HTTPOnly == b.HTTPOnly &&
+		a.Secure == b.Secure &&
+		a.AutoSecure == b.AutoSecure &&
+		a.RejectDowngrade == b.RejectDowngrade &&
+		a.SameSite == b.SameSite &&
+		a.SameSiteUACompat == b.SameSiteUACompat &&
+		a.CookieName == b.CookieName &&
+		a.ReadCookieName == b.ReadCookieName &&
+		a.WriteCookieName == b.WriteCookieName &&
+		a.providedAuthKey() == b.providedAuthKey() &&
+		a.providedEncryptKey() == b.providedEncryptKey() &&
+		bytes.Equal(a.AuthKeyBytes, b.AuthKeyBytes) &&
+		bytes.Equal(a.EncryptKeyBytes, b.EncryptKeyBytes) &&
+		a.Priority == b.Priority &&
+		a.Encoding == b.Encoding &&
+		a.RejectWeakKeys == b.RejectWeakKeys &&
+		a.DisableRandomKeyFallback == b.DisableRandomKeyFallback &&
+		reflect.DeepEqual(a.FallbackCookieNames, b.FallbackCookieNames) &&
+		a.RejectNewSessions == b.RejectNewSessions &&
+		reflect.DeepEqual(a.Defaults, b.Defaults) &&
+		a.SkipUnchanged == b.SkipUnchanged &&
+		sameFunc(a.IDGenerator, b.IDGenerator) &&
+		sameFunc(a.ValueEncoder, b.ValueEncoder) &&
+		sameFunc(a.ValueDecoder, b.ValueDecoder) &&
+		a.AllowChunking == b.AllowChunking &&
+		a.CompressMinBytes == b.CompressMinBytes &&
+		a.Audience == b.Audience &&
+		a.NormalizeKeys == b.NormalizeKeys &&
+		a.MaxValueBytes == b.MaxValueBytes &&
+		a.AutoExtend == b.AutoExtend &&
+		a.ResetIncompatibleData == b.ResetIncompatibleData &&
+		sameFunc(a.OnDecodeError, b.OnDecodeError) &&
+		sameFunc(a.MigrateFrom, b.MigrateFrom) &&
+		a.IdleTimeout == b.IdleTimeout &&
+		a.AbsoluteTimeout == b.AbsoluteTimeout &&
+		a.CodeAttempts == b.CodeAttempts &&
+		a.CodeLifetime == b.CodeLifetime &&
+		sameStore(a.Overflow, b.Overflow) &&
+		a.OverflowMinBytes == b.OverflowMinBytes &&
+		a.InactivityRedirect == b.InactivityRedirect &&
+		a.InactivityStatus == b.InactivityStatus &&
+		sameFunc(a.OnConflict, b.OnConflict) &&
+		a.MaxTrackedVersions == b.MaxTrackedVersions &&
+		a.sso == b.sso &&
+		a.hardened == b.hardened &&
+		reflect.DeepEqual(a.companions, b.companions)
+}
+
+//providedAuthKey returns the AuthKey unless it was generated by Init.
+func (c *Config) providedAuthKey() string {
+	if c.AuthKey == c.generatedAuthKey {
+		return ""
+	}
+	return c.AuthKey
+}
+
+//providedEncryptKey returns the EncryptKey unless it was generated by Init.
+func (c *Config) providedEncryptKey() string {
+	if c.EncryptKey == c.generatedEncryptKey {
+		return ""
+	}
+	return c.EncryptKey
+}
+
+//sameFunc returns true if two funcs are both nil or point to the same code. Closures
+//created by the same func literal are treated as the same.
+func sameFunc(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.IsNil() || vb.IsNil() {
+		return va.IsNil() == vb.IsNil()
+	}
+	return va.Pointer() == vb.Pointer()
+}
+
+//sameStore returns true if two overflow stores are both nil or are the same store. Stores
+//that cannot be compared, such as a map type, are never the same.
+func sameStore(a, b OverflowStore) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	if ta != tb || !ta.Comparable() {
+		return false
+	}
+	return a == b
+}
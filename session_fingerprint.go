@@ -0,0 +1,100 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines tooling for detecting a session cookie being used by a client other than
+the one it was issued to. A random nonce is stored in the session and, signed, in a
+companion cookie. On each request checked with CheckFingerprint, the nonce in the session
+must match the companion cookie and, if it does, a new nonce is stored in both.
+
+This detects naive cloning, where only the session cookie is copied to another client, and
+replaying a session cookie captured before the nonce was rotated without the matching
+companion cookie. It does not detect both cookies being copied together since session data
+is stored only in the cookies.
+*/
+
+package session
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+const (
+	//keyFingerprint is the key in the session the fingerprint nonce is stored under.
+	keyFingerprint = keyPrefixInternal + "fingerprint"
+
+	//fingerprintCookieSuffix is appended to the CookieName to name the companion cookie.
+	fingerprintCookieSuffix = "_fp"
+
+	//fingerprintName is the name used when signing the fingerprint nonce.
+	fingerprintName = "session_fingerprint"
+
+	//fingerprintLength is the number of random bytes used for a fingerprint nonce.
+	fingerprintLength = 16
+)
+
+//fingerprintCookieName returns the name of the companion cookie the fingerprint nonce is
+//stored in.
+func (c *Config) fingerprintCookieName() string {
+	return c.CookieName + fingerprintCookieSuffix
+}
+
+//CheckFingerprint checks that the fingerprint nonce stored in the session matches the
+//nonce in the companion cookie and rotates the nonce, saving the session. If the session
+//does not have a nonce yet, one is issued. ErrReplayDetected is returned if the nonces do
+//not match, or the companion cookie is missing or has been modified, in which case the
+//session should be treated as compromised, for example by calling Destroy.
+func (c *Config) CheckFingerprint(w http.ResponseWriter, r *http.Request) (err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	if stored, exists := s.Values[keyFingerprint].(string); exists {
+		cookie, cErr := r.Cookie(c.fingerprintCookieName())
+		if cErr != nil {
+			return ErrReplayDetected
+		}
+
+		var nonce string
+		err = c.signer().Decode(fingerprintName, cookie.Value, &nonce)
+		if err != nil || nonce != stored {
+			return ErrReplayDetected
+		}
+	}
+
+	b, err := randomBytes(fingerprintLength)
+	if err != nil {
+		return
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+
+	signed, err := c.signer().Encode(fingerprintName, nonce)
+	if err != nil {
+		return
+	}
+
+	s.Values[keyFingerprint] = nonce
+	err = c.save(w, r, s)
+	if err != nil {
+		return
+	}
+
+	ops := c.getOptions()
+	ops.MaxAge = c.effectiveMaxAge(s)
+	ops.Domain = c.domainFor(r)
+	c.applyAutoSecure(r, ops)
+	c.applySameSiteCompat(r, ops)
+	c.setCookie(w, sessions.NewCookie(c.fingerprintCookieName(), signed, ops))
+
+	return
+}
+
+//CheckFingerprint checks and rotates the fingerprint nonce using the default package level
+//config.
+func CheckFingerprint(w http.ResponseWriter, r *http.Request) (err error) {
+	return config.CheckFingerprint(w, r)
+}
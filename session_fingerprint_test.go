@@ -0,0 +1,102 @@
+package session
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckFingerprint(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//first request issues the fingerprint
+	w := httptest.NewRecorder()
+	err = cfg.CheckFingerprint(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 2 {
+		t.Fatal("session and fingerprint cookies should have been set", cookies)
+		return
+	}
+
+	//matching cookies, fingerprint is rotated
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	err = cfg.CheckFingerprint(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//only the session cookie is copied
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	err = cfg.CheckFingerprint(httptest.NewRecorder(), req)
+	if err != ErrReplayDetected {
+		t.Fatal("ErrReplayDetected should have occured but didn't", err)
+		return
+	}
+
+	//rotated session cookie with the old fingerprint cookie
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	for _, c := range cookies {
+		if c.Name == cfg.fingerprintCookieName() {
+			req.AddCookie(c)
+		}
+	}
+	err = cfg.CheckFingerprint(httptest.NewRecorder(), req)
+	if err != ErrReplayDetected {
+		t.Fatal("ErrReplayDetected should have occured but didn't", err)
+		return
+	}
+}
+
+func TestCheckFingerprintMaxAge(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	err = cfg.SaveWithLifetime(w, req, 30*24*time.Hour)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w = httptest.NewRecorder()
+	err = cfg.CheckFingerprint(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	maxAges := make(map[string]int)
+	for _, c := range w.Result().Cookies() {
+		maxAges[c.Name] = c.MaxAge
+	}
+	if maxAges[cfg.fingerprintCookieName()] != int((30*24*time.Hour).Seconds()) || maxAges[cfg.fingerprintCookieName()] != maxAges[cfg.CookieName] {
+		t.Fatal("fingerprint cookie should have used the session's lifetime", maxAges)
+		return
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines helper functions for flash messages. Flash messages are stored in the
+session until they are read, typically on the next page load, and are grouped by category
+(ex.: "error", "success") so they can be displayed appropriately.
+*/
+
+package session
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+//keyPrefixFlash is prepended to a flash message's category to build the key the messages
+//are stored under. This allows finding every category when draining all flashes. The prefix
+//is reserved so flash messages cannot be overwritten with AddValue.
+const keyPrefixFlash = keyPrefixInternal + "flash:"
+
+//AddFlash adds a flash message to the session under a category.
+func (c *Config) AddFlash(w http.ResponseWriter, r *http.Request, category, message string) (err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	//gorilla/sessions assumes the stored value holds flashes
+	key := keyPrefixFlash + category
+	if _, ok := s.Values[key].([]interface{}); !ok {
+		delete(s.Values, key)
+	}
+	s.AddFlash(message, key)
+
+	err = c.save(w, r, s)
+	return
+}
+
+//AddFlash adds a flash message to the session using the default package level config.
+func AddFlash(w http.ResponseWriter, r *http.Request, category, message string) error {
+	return config.AddFlash(w, r, category, message)
+}
+
+//Flashes returns and clears the flash messages stored for a category. The session is only
+//saved if messages existed.
+func (c *Config) Flashes(w http.ResponseWriter, r *http.Request, category string) (messages []string, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	messages, found := takeFlashes(s, keyPrefixFlash+category)
+	if !found {
+		return
+	}
+
+	err = c.save(w, r, s)
+	return
+}
+
+//Flashes returns and clears the flash messages for a category using the default package
+//level config.
+func Flashes(w http.ResponseWriter, r *http.Request, category string) (messages []string, err error) {
+	return config.Flashes(w, r, category)
+}
+
+//DrainFlashes returns and clears the flash messages stored for every category, grouped by
+//category. The session is only saved if messages existed.
+func (c *Config) DrainFlashes(w http.ResponseWriter, r *http.Request) (flashes map[string][]string, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	flashes = make(map[string][]string)
+	found := false
+	for k := range s.Values {
+		key, ok := k.(string)
+		if !ok || !strings.HasPrefix(key, keyPrefixFlash) {
+			continue
+		}
+
+		messages, exists := takeFlashes(s, key)
+		found = found || exists
+		if len(messages) > 0 {
+			flashes[strings.TrimPrefix(key, keyPrefixFlash)] = messages
+		}
+	}
+
+	if !found {
+		return
+	}
+
+	err = c.save(w, r, s)
+	return
+}
+
+//DrainFlashes returns and clears all flash messages using the default package level config.
+func DrainFlashes(w http.ResponseWriter, r *http.Request) (flashes map[string][]string, err error) {
+	return config.DrainFlashes(w, r)
+}
+
+//takeFlashes returns and removes the flash messages stored under a key. A value that does not
+//hold flashes is removed without calling into gorilla/sessions, which would panic on it.
+//Found is true if anything was stored under the key.
+func takeFlashes(s *sessions.Session, key string) (messages []string, found bool) {
+	v, found := s.Values[key]
+	if !found {
+		return
+	}
+
+	if _, ok := v.([]interface{}); !ok {
+		delete(s.Values, key)
+		return
+	}
+
+	return flashStrings(s.Flashes(key)), true
+}
+
+//flashStrings converts flash messages as returned from gorilla/sessions to strings.
+func flashStrings(raw []interface{}) (messages []string) {
+	for _, f := range raw {
+		if m, ok := f.(string); ok {
+			messages = append(messages, m)
+		}
+	}
+	return
+}
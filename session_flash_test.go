@@ -0,0 +1,117 @@
+package session
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFlashes(t *testing.T) {
+	cfg := TestConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	cfg.AddFlash(w, req, "error", "something failed")
+	cfg.AddFlash(w, req, "error", "something else failed")
+	err = cfg.AddFlash(w, req, "success", "saved")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//flashes must survive being encoded in the cookie
+	encoded, _ := cfg.ExtractCookie(w)
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	w = httptest.NewRecorder()
+
+	messages, err := cfg.Flashes(w, req, "success")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(messages) != 1 || messages[0] != "saved" {
+		t.Fatal("flashes not retrieved", messages)
+		return
+	}
+
+	cfg.AddFlash(w, req, "info", "hello")
+	flashes, err := cfg.DrainFlashes(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(flashes) != 2 || len(flashes["error"]) != 2 || len(flashes["info"]) != 1 {
+		t.Fatal("flashes not drained", flashes)
+		return
+	}
+
+	flashes, _ = cfg.DrainFlashes(w, req)
+	if len(flashes) != 0 {
+		t.Fatal("flashes not cleared", flashes)
+		return
+	}
+}
+
+func TestFlashesReserved(t *testing.T) {
+	cfg := TestConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, keyPrefixFlash+"notice", "hi")
+	if err != ErrReservedKey {
+		t.Fatal("ErrReservedKey should have occured but didn't", err)
+		return
+	}
+
+	//user keys that look like flash keys do not collide with flashes
+	err = cfg.AddValue(w, req, "flash:notice", "hi")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = cfg.AddFlash(w, req, "notice", "saved")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	n, err := cfg.CountValuesNS(req, "")
+	if err != nil || n != 1 {
+		t.Fatal("flashes should not be counted as user values", n, err)
+		return
+	}
+
+	//values that do not hold flashes are dropped rather than panicking
+	s, _ := cfg.GetSession(req)
+	s.Values[keyPrefixFlash+"notice"] = "corrupt"
+	messages, err := cfg.Flashes(w, req, "notice")
+	if err != nil || len(messages) != 0 {
+		t.Fatal("corrupt flashes should have been dropped", messages, err)
+		return
+	}
+	if _, exists := s.Values[keyPrefixFlash+"notice"]; exists {
+		t.Fatal("corrupt flashes should have been removed")
+		return
+	}
+
+	s.Values[keyPrefixFlash+"notice"] = "corrupt"
+	err = cfg.AddFlash(w, req, "notice", "saved")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	flashes, err := cfg.DrainFlashes(w, req)
+	if err != nil || len(flashes["notice"]) != 1 {
+		t.Fatal("flashes not drained", flashes, err)
+		return
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines helper functions for storing hashes of values in the session rather
+than the values themselves, and for comparing provided values against the stored hashes.
+This also defines storing one-time codes, such as for step-up authentication, that can be
+verified a limited number of times.
+
+The state of a stored code, the hash, attempts remaining, and expiration, is kept in the
+Overflow store when one is set. This is required for the attempts limit to protect against
+brute force guessing since a client can otherwise replay an earlier cookie to restore
+attempts already used or to reuse a code that was already verified. Without an Overflow
+store the state is kept in the cookie and the attempts limit and one-time use only apply to
+clients that send back the cookie they were last given.
+*/
+
+package session
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//keyPrefixCode is prepended to the key provided to StoreCodeHash. The value stored is the
+//hash of the code, the number of attempts remaining, and the unix timestamp the code
+//expires at, separated by commas.
+const keyPrefixCode = keyPrefixInternal + "code:"
+
+//defaultCodeAttempts and defaultCodeLifetime are used when CodeAttempts and CodeLifetime
+//are not set.
+const (
+	defaultCodeAttempts = 5
+	defaultCodeLifetime = 10 * time.Minute
+)
+
+//hashValue returns the hex encoded SHA-256 hash of a value.
+func hashValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+//AddHashedMarker stores the SHA-256 hash of a value in the session. This is useful for
+//storing a tamper-evident marker, such as the time a user's password was last changed,
+//without storing the raw value in the cookie. Use VerifyMarker to check a value against
+//the stored hash.
+func (c *Config) AddHashedMarker(w http.ResponseWriter, r *http.Request, key, value string) error {
+	return c.AddValue(w, r, key, hashValue(value))
+}
+
+//AddHashedMarker stores the hash of a value using the default package level config.
+func AddHashedMarker(w http.ResponseWriter, r *http.Request, key, value string) error {
+	return config.AddHashedMarker(w, r, key, value)
+}
+
+//VerifyMarker hashes the provided value and compares it, in constant time, to the hash
+//stored in the session by AddHashedMarker. ErrKeyNotFound is returned if no marker is
+//stored for the key.
+func (c *Config) VerifyMarker(r *http.Request, key, value string) (match bool, err error) {
+	stored, err := c.GetValue(r, key)
+	if err != nil {
+		return
+	}
+
+	match = subtle.ConstantTimeCompare([]byte(stored), []byte(hashValue(value))) == 1
+	return
+}
+
+//VerifyMarker compares a value to a stored hash using the default package level config.
+func VerifyMarker(r *http.Request, key, value string) (match bool, err error) {
+	return config.VerifyMarker(r, key, value)
+}
+
+//StoreCodeHash stores the SHA-256 hash of a one-time code along with the number of attempts
+//allowed and the time the code expires, per CodeAttempts and CodeLifetime. Storing a code
+//for a key replaces any code previously stored for the key. Use VerifyCode to check a code
+//entered by the user.
+//
+//The code's state is kept in the Overflow store if one is set. Otherwise it is kept in the
+//cookie and provides no protection against brute force guessing or reuse by a client that
+//replays an earlier cookie, see the file comment.
+func (c *Config) StoreCodeHash(w http.ResponseWriter, r *http.Request, key, code string) (err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	attempts := c.CodeAttempts
+	if attempts < 1 {
+		attempts = defaultCodeAttempts
+	}
+
+	lifetime := c.CodeLifetime
+	if lifetime <= 0 {
+		lifetime = defaultCodeLifetime
+	}
+
+	expires := nowFunc().Add(lifetime).Unix()
+	err = c.setInternalValue(s, keyPrefixCode+key, hashValue(code)+","+strconv.Itoa(attempts)+","+strconv.FormatInt(expires, 10))
+	if err != nil {
+		return
+	}
+
+	err = c.save(w, r, s)
+	return
+}
+
+//StoreCodeHash stores the hash of a one-time code using the default package level config.
+func StoreCodeHash(w http.ResponseWriter, r *http.Request, key, code string) (err error) {
+	return config.StoreCodeHash(w, r, key, code)
+}
+
+//VerifyCode compares a code, in constant time, to the hash stored by StoreCodeHash and
+//saves the session. If the code matches, it is removed so it cannot be used again. If the
+//code does not match, the number of attempts remaining is decremented and the code is
+//removed once no attempts remain. ErrCodeExpired is returned if the code has expired or no
+//attempts remain, and ErrKeyNotFound is returned if no code is stored for the key.
+//
+//Attempts are only counted across replayed cookies when an Overflow store is set. The
+//Overflow store is not updated atomically, so concurrent requests for the same session can
+//each use the same attempt.
+func (c *Config) VerifyCode(w http.ResponseWriter, r *http.Request, key, code string) (ok bool, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	k := keyPrefixCode + key
+	v, exists, err := c.internalValue(s, k)
+	if err != nil {
+		return
+	}
+	if !exists {
+		return false, ErrKeyNotFound
+	}
+
+	parts := strings.SplitN(v, ",", 3)
+	if len(parts) != 3 {
+		return false, ErrKeyNotFound
+	}
+
+	attempts, aErr := strconv.Atoi(parts[1])
+	expires, eErr := strconv.ParseInt(parts[2], 10, 64)
+	if aErr != nil || eErr != nil || attempts < 1 || !nowFunc().Before(time.Unix(expires, 0)) {
+		err = c.deleteInternalValue(s, k)
+		if err != nil {
+			return
+		}
+
+		err = c.save(w, r, s)
+		if err != nil {
+			return
+		}
+
+		return false, ErrCodeExpired
+	}
+
+	ok = subtle.ConstantTimeCompare([]byte(parts[0]), []byte(hashValue(code))) == 1
+	if ok || attempts == 1 {
+		err = c.deleteInternalValue(s, k)
+	} else {
+		err = c.setInternalValue(s, k, parts[0]+","+strconv.Itoa(attempts-1)+","+parts[2])
+	}
+	if err != nil {
+		return false, err
+	}
+
+	err = c.save(w, r, s)
+	return
+}
+
+//VerifyCode checks a one-time code against the stored hash using the default package
+//level config.
+func VerifyCode(w http.ResponseWriter, r *http.Request, key, code string) (ok bool, err error) {
+	return config.VerifyCode(w, r, key, code)
+}
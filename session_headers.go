@@ -0,0 +1,127 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines middleware that sets cache related headers on responses to requests
+that use sessions. Without these headers a shared cache, such as a CDN or proxy, may
+cache a page rendered for one user's session and serve it to other users.
+
+This file also defines middleware that records when the response headers are written so
+that saving a session afterwards returns ErrHeadersAlreadySent. net/http drops headers set
+after the headers are written, so without this the session cookie is silently not set.
+*/
+
+package session
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+//SecureHeadersMiddleware returns middleware that adds "Vary: Cookie" to every response
+//so caches key responses by the cookies sent. If the request carried an existing session,
+//"Cache-Control: private" is also set, before the next handler is called, so shared caches
+//do not store the response at all. The next handler can replace the Cache-Control header.
+//Nothing is written if the next handler does not write a response, so the status code is
+//left to the caller. The ResponseWriter passed to the next handler supports http.Flusher
+//and http.Hijacker when the underlying ResponseWriter does.
+func (c *Config) SecureHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Cookie")
+
+		s, err := c.GetSession(r)
+		if err != nil || s.IsNew {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "private")
+		next.ServeHTTP(&headerTracker{ResponseWriter: w}, r)
+	})
+}
+
+//SecureHeadersMiddleware returns middleware that sets cache related headers using the
+//default package level config.
+func SecureHeadersMiddleware(next http.Handler) http.Handler {
+	return config.SecureHeadersMiddleware(next)
+}
+
+//HeadersSentMiddleware returns middleware that records when the response headers are
+//written, either by WriteHeader or by the first call to Write. Saving a session after the
+//headers were written returns ErrHeadersAlreadySent rather than the session cookie being
+//silently dropped. This should be the outermost middleware that uses sessions. Whether
+//the headers were written can only be detected when the ResponseWriter was wrapped by this
+//middleware or by SecureHeadersMiddleware. The ResponseWriter passed to the next handler
+//supports http.Flusher and http.Hijacker when the underlying ResponseWriter does, and
+//flushing counts as writing the headers.
+func HeadersSentMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&headerTracker{ResponseWriter: w}, r)
+	})
+}
+
+//headerTracker records if the headers have been written.
+type headerTracker struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+//WriteHeader records that the headers were written and writes the status code.
+func (ht *headerTracker) WriteHeader(status int) {
+	ht.wroteHeader = true
+	ht.ResponseWriter.WriteHeader(status)
+}
+
+//Write records that the headers were written and writes the body.
+func (ht *headerTracker) Write(b []byte) (int, error) {
+	ht.wroteHeader = true
+	return ht.ResponseWriter.Write(b)
+}
+
+//Flush records that the headers were written, since flushing writes them, and flushes
+//buffered data to the client if the underlying ResponseWriter supports it.
+func (ht *headerTracker) Flush() {
+	ht.wroteHeader = true
+	http.NewResponseController(ht.ResponseWriter).Flush()
+}
+
+//Hijack lets the caller take over the connection if the underlying ResponseWriter supports
+//it, http.ErrNotSupported is returned otherwise. The headers are recorded as written once
+//the connection is hijacked since they can no longer be set.
+func (ht *headerTracker) Hijack() (conn net.Conn, rw *bufio.ReadWriter, err error) {
+	conn, rw, err = http.NewResponseController(ht.ResponseWriter).Hijack()
+	if err == nil {
+		ht.wroteHeader = true
+	}
+
+	return
+}
+
+//Unwrap returns the underlying ResponseWriter for use with http.ResponseController.
+func (ht *headerTracker) Unwrap() http.ResponseWriter {
+	return ht.ResponseWriter
+}
+
+//headersWritten returns true once the headers have been written.
+func (ht *headerTracker) headersWritten() bool {
+	return ht.wroteHeader
+}
+
+//headersSent returns true if w, or a ResponseWriter it wraps, is known to have written the
+//headers already.
+func headersSent(w http.ResponseWriter) bool {
+	for w != nil {
+		if t, ok := w.(interface{ headersWritten() bool }); ok && t.headersWritten() {
+			return true
+		}
+
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
+
+	return false
+}
@@ -0,0 +1,108 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines tooling for inspecting a session, for example for building an admin
+"current session" page or for debugging.
+*/
+
+package session
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+//SessionInfo is the set of values and metadata for a session, as returned by Inspect().
+type SessionInfo struct {
+	//Values are the user values stored in the session that are strings. Values this
+	//package stores for its own bookkeeping are not included.
+	Values map[string]string
+
+	//IsNew is true if the request did not carry an existing session.
+	IsNew bool
+
+	//CookieName is the name of the cookie the session is stored in.
+	CookieName string
+
+	//Options are the options the cookie will be set with when the session is saved.
+	Options *sessions.Options
+
+	//Lifetime is how long the cookie will last after the session is next saved. This takes
+	//into account lifetimes set with SaveWithLifetime and AddTokenWithExpiry.
+	Lifetime time.Duration
+
+	//CreatedAt is the time the session was first saved. This is the zero time if the
+	//session has never been saved.
+	CreatedAt time.Time
+
+	//LastActivity is the time of the last request as recorded by InactivityGuard. This is
+	//the zero time if it was never recorded.
+	LastActivity time.Time
+
+	//TokenExpiresAt is the time the token expires as set by AddTokenWithExpiry. This is
+	//the zero time if no expiration was set.
+	TokenExpiresAt time.Time
+}
+
+//Inspect returns the values and metadata for the session of a request.
+func (c *Config) Inspect(r *http.Request) (info *SessionInfo, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	values, err := c.userValues(s)
+	if err != nil {
+		return
+	}
+
+	ops := c.EffectiveOptions()
+	ops.Domain = c.domainFor(r)
+
+	info = &SessionInfo{
+		Values:         values,
+		IsNew:          s.IsNew,
+		CookieName:     c.CookieName,
+		Options:        ops,
+		Lifetime:       time.Duration(ops.MaxAge) * time.Second,
+		CreatedAt:      unixValue(s, keyCreatedAt),
+		LastActivity:   unixValue(s, keyLastActivity),
+		TokenExpiresAt: unixValue(s, keyTokenExpiresAt),
+	}
+
+	if v, exists := s.Values[keyLifetime].(string); exists {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			info.Lifetime = time.Duration(seconds) * time.Second
+		}
+	}
+	if !info.TokenExpiresAt.IsZero() {
+		info.Lifetime = info.TokenExpiresAt.Sub(nowFunc())
+	}
+
+	return
+}
+
+//Inspect returns the values and metadata for a session using the default package level config.
+func Inspect(r *http.Request) (info *SessionInfo, err error) {
+	return config.Inspect(r)
+}
+
+//unixValue returns the time stored as a unix timestamp under a key, or the zero time if the
+//key does not exist or is not a valid timestamp.
+func unixValue(s *sessions.Session, key string) time.Time {
+	v, exists := s.Values[key].(string)
+	if !exists {
+		return time.Time{}
+	}
+
+	unix, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(unix, 0)
+}
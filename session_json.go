@@ -0,0 +1,67 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines helper functions for working with JSON. Raw JSON can be stored in a
+session as a string exactly as provided, it is never unmarshaled, so field ordering and
+number precision are preserved when it is retrieved. Values can also be returned as JSON
+for passing to client side code.
+*/
+
+package session
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+//AddValueJSONRaw stores a raw JSON value in the session under key. ErrInvalidJSON is
+//returned if raw is not valid JSON.
+func (c *Config) AddValueJSONRaw(w http.ResponseWriter, r *http.Request, key string, raw json.RawMessage) (err error) {
+	if !json.Valid(raw) {
+		return ErrInvalidJSON
+	}
+
+	return c.AddValue(w, r, key, string(raw))
+}
+
+//AddValueJSONRaw stores a raw JSON value in the session using the default package level config.
+func AddValueJSONRaw(w http.ResponseWriter, r *http.Request, key string, raw json.RawMessage) (err error) {
+	return config.AddValueJSONRaw(w, r, key, raw)
+}
+
+//GetValueJSONRaw retrieves a raw JSON value stored in the session with AddValueJSONRaw.
+//ErrKeyNotFound is returned if the key does not exist.
+func (c *Config) GetValueJSONRaw(r *http.Request, key string) (raw json.RawMessage, err error) {
+	value, err := c.GetValue(r, key)
+	if err != nil {
+		return
+	}
+
+	return json.RawMessage(value), nil
+}
+
+//GetValueJSONRaw retrieves a raw JSON value stored in the session using the default package
+//level config.
+func GetValueJSONRaw(r *http.Request, key string) (raw json.RawMessage, err error) {
+	return config.GetValueJSONRaw(r, key)
+}
+
+//ValuesAsJSON returns the values for only the given keys as a JSON object, for example to
+//hydrate a client side store on page load. Keys are filtered the same as ExportValues, so
+//the token and keys this package uses for its own bookkeeping are never included. Keys
+//that do not exist are omitted.
+func (c *Config) ValuesAsJSON(r *http.Request, keys ...string) (b []byte, err error) {
+	kv, err := c.ExportValues(r, keys...)
+	if err != nil {
+		return
+	}
+
+	return json.Marshal(kv)
+}
+
+//ValuesAsJSON returns the values for only the given keys as a JSON object using the default
+//package level config.
+func ValuesAsJSON(r *http.Request, keys ...string) (b []byte, err error) {
+	return config.ValuesAsJSON(r, keys...)
+}
@@ -0,0 +1,96 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines a functional options constructor for configs as an alternative to
+setting fields on a config returned by NewConfig and then calling Init.
+
+	cfg, err := session.New(
+		session.WithKeys(authKey, encryptKey),
+		session.WithMaxAge(24*time.Hour),
+		session.WithSecure(true),
+	)
+*/
+
+package session
+
+import (
+	"net/http"
+	"time"
+)
+
+//Option is a func that modifies a config, used with New.
+type Option func(c *Config)
+
+//New returns a config with the defaults from NewConfig, modified by each option in order,
+//and initialized with Init. The config is ready to use if no error is returned.
+func New(opts ...Option) (c *Config, err error) {
+	c = NewConfig()
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	err = c.Init()
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+//WithDomain sets the Domain.
+func WithDomain(domain string) Option {
+	return func(c *Config) {
+		c.Domain = domain
+	}
+}
+
+//WithPath sets the Path.
+func WithPath(path string) Option {
+	return func(c *Config) {
+		c.Path = path
+	}
+}
+
+//WithMaxAge sets the MaxAge.
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(c *Config) {
+		c.MaxAge = maxAge
+	}
+}
+
+//WithKeys sets the AuthKey and EncryptKey.
+func WithKeys(authKey, encryptKey string) Option {
+	return func(c *Config) {
+		c.AuthKey = authKey
+		c.EncryptKey = encryptKey
+	}
+}
+
+//WithSecure sets Secure.
+func WithSecure(yes bool) Option {
+	return func(c *Config) {
+		c.Secure = yes
+	}
+}
+
+//WithHTTPOnly sets HTTPOnly.
+func WithHTTPOnly(yes bool) Option {
+	return func(c *Config) {
+		c.HTTPOnly = yes
+	}
+}
+
+//WithSameSite sets the SameSite.
+func WithSameSite(sameSite http.SameSite) Option {
+	return func(c *Config) {
+		c.SameSite = sameSite
+	}
+}
+
+//WithCookieName sets the CookieName.
+func WithCookieName(cookieName string) Option {
+	return func(c *Config) {
+		c.CookieName = cookieName
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines support for storing large values in a server side store rather than in
+the cookie. This keeps small values, such as a user ID, in the cookie where reading them
+does not require a lookup while keeping the cookie small when large values, such as a
+computed permission set, are stored.
+
+Values stored in the overflow store are keyed by an overflow ID, which is generated and
+stored in the cookie the first time a value overflows. This ID is reserved for this
+package's use so it is not changed by AddSessionID, SessionIdentifier, or rotating the
+session ID. The cookie records which keys were overflowed so that lookups are only made
+for keys that are known to be in the store. Entries are deleted from the store when the
+value is replaced by a value small enough to store in the cookie, when the value is
+removed, and when the session is destroyed.
+*/
+
+package session
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+//OverflowStore is a server side store for session values that are too large to store in
+//the cookie. Implementations must be safe for concurrent use.
+type OverflowStore interface {
+	//Get returns the value stored for a key for a session. Exists is false if no value is
+	//stored.
+	Get(sessionID, key string) (value string, exists bool, err error)
+
+	//Set stores a value for a key for a session, replacing any existing value.
+	Set(sessionID, key, value string) error
+
+	//Delete removes the value stored for a key for a session. Deleting a key that is not
+	//stored is not an error.
+	Delete(sessionID, key string) error
+}
+
+const (
+	//keyPrefixOverflow is prepended to a key to record that the value for the key is stored
+	//in the overflow store rather than in the cookie.
+	keyPrefixOverflow = keyPrefixInternal + "overflow:"
+
+	//keyOverflowID is the key in the session the ID used for the session's entries in the
+	//overflow store is stored under.
+	keyOverflowID = keyPrefixInternal + "overflow_id"
+)
+
+//storeValue sets the value for a key in the session, storing it in the overflow store
+//instead of the session if it is larger than OverflowMinBytes. An overflow ID is generated
+//if a value overflows and the session does not have one yet. If the value previously
+//overflowed but now fits in the cookie, the entry in the overflow store is deleted.
+func (c *Config) storeValue(s *sessions.Session, key, value string) (err error) {
+	if c.Overflow == nil || len(value) <= c.OverflowMinBytes {
+		err = c.deleteOverflowValue(s, key)
+		if err != nil {
+			return
+		}
+
+		s.Values[key] = value
+		return
+	}
+
+	return c.setOverflowValue(s, key, value)
+}
+
+//setOverflowValue stores the value for a key in the overflow store, regardless of its size,
+//and records in the session that the value was overflowed. An overflow ID is generated if
+//the session does not have one yet.
+func (c *Config) setOverflowValue(s *sessions.Session, key, value string) (err error) {
+	id, exists := s.Values[keyOverflowID].(string)
+	if !exists || id == "" {
+		b, rErr := randomBytes(sessionIdentifierLength)
+		if rErr != nil {
+			return rErr
+		}
+		id = base64.RawURLEncoding.EncodeToString(b)
+		s.Values[keyOverflowID] = id
+	}
+
+	err = c.Overflow.Set(id, key, value)
+	if err != nil {
+		return
+	}
+
+	delete(s.Values, key)
+	s.Values[keyPrefixOverflow+key] = "1"
+	return
+}
+
+//overflowValue returns the value for a key from the overflow store if the session records
+//that the value was overflowed.
+func (c *Config) overflowValue(s *sessions.Session, key string) (value string, exists bool, err error) {
+	if c.Overflow == nil {
+		return
+	}
+	if _, overflowed := s.Values[keyPrefixOverflow+key]; !overflowed {
+		return
+	}
+
+	id, _ := s.Values[keyOverflowID].(string)
+	if id == "" {
+		return
+	}
+
+	return c.Overflow.Get(id, key)
+}
+
+//deleteOverflowValue removes the value for a key from the overflow store, if the session
+//records that the value was overflowed, and removes the record from the session.
+func (c *Config) deleteOverflowValue(s *sessions.Session, key string) (err error) {
+	if _, overflowed := s.Values[keyPrefixOverflow+key]; !overflowed {
+		return
+	}
+
+	id, _ := s.Values[keyOverflowID].(string)
+	if c.Overflow != nil && id != "" {
+		err = c.Overflow.Delete(id, key)
+		if err != nil {
+			return
+		}
+	}
+
+	delete(s.Values, keyPrefixOverflow+key)
+	return
+}
+
+//overflowKeys returns the keys whose values are stored in the overflow store.
+func overflowKeys(s *sessions.Session) (keys []string) {
+	for k := range s.Values {
+		ks, ok := k.(string)
+		if ok && strings.HasPrefix(ks, keyPrefixOverflow) {
+			keys = append(keys, strings.TrimPrefix(ks, keyPrefixOverflow))
+		}
+	}
+
+	return
+}
+
+//deleteOverflow removes every value stored in the overflow store for the session.
+func (c *Config) deleteOverflow(s *sessions.Session) (err error) {
+	for _, key := range overflowKeys(s) {
+		err = c.deleteOverflowValue(s, key)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+//internalValue returns a value this package keeps for its own bookkeeping, from the
+//overflow store if one is set or from the session otherwise. This is used for state that a
+//client should not be able to restore by replaying an earlier cookie.
+func (c *Config) internalValue(s *sessions.Session, key string) (value string, exists bool, err error) {
+	if c.Overflow == nil {
+		value, exists = s.Values[key].(string)
+		return
+	}
+
+	return c.overflowValue(s, key)
+}
+
+//setInternalValue stores a value this package keeps for its own bookkeeping, in the
+//overflow store if one is set or in the session otherwise.
+func (c *Config) setInternalValue(s *sessions.Session, key, value string) (err error) {
+	if c.Overflow == nil {
+		s.Values[key] = value
+		return
+	}
+
+	return c.setOverflowValue(s, key, value)
+}
+
+//deleteInternalValue removes a value stored with setInternalValue from the session and the
+//overflow store.
+func (c *Config) deleteInternalValue(s *sessions.Session, key string) (err error) {
+	delete(s.Values, key)
+	return c.deleteOverflowValue(s, key)
+}
@@ -0,0 +1,462 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//memoryOverflow is an in memory OverflowStore for tests.
+type memoryOverflow struct {
+	mu     sync.Mutex
+	values map[string]map[string]string
+}
+
+func (m *memoryOverflow) Get(sessionID, key string) (value string, exists bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, exists = m.values[sessionID][key]
+	return
+}
+
+func (m *memoryOverflow) Set(sessionID, key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.values[sessionID] == nil {
+		m.values[sessionID] = make(map[string]string)
+	}
+	m.values[sessionID][key] = value
+	return nil
+}
+
+func (m *memoryOverflow) Delete(sessionID, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values[sessionID], key)
+	if len(m.values[sessionID]) == 0 {
+		delete(m.values, sessionID)
+	}
+	return nil
+}
+
+func TestOverflowStore(t *testing.T) {
+	store := &memoryOverflow{values: make(map[string]map[string]string)}
+
+	cfg := TestConfig()
+	cfg.Overflow = store
+	cfg.OverflowMinBytes = 64
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	large := strings.Repeat("permission,", 50)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	err = cfg.AddValue(w, req, "user_id", "2554")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = cfg.AddValue(w, req, "permissions", large)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(store.values) != 1 {
+		t.Fatal("large value should have been stored in the overflow store", store.values)
+		return
+	}
+
+	//values are read back from a new request
+	w = httptest.NewRecorder()
+	err = cfg.Extend(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(encoded) > len(large) {
+		t.Fatal("large value should not be stored in the cookie")
+		return
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	v, err := cfg.GetValue(req, "permissions")
+	if err != nil || v != large {
+		t.Fatal("large value should have been read from the overflow store", err)
+		return
+	}
+	kv, err := cfg.GetValues(req, "user_id", "permissions")
+	if err != nil || kv["user_id"] != "2554" || kv["permissions"] != large {
+		t.Fatal("values should have been returned", kv, err)
+		return
+	}
+
+	//values are moved when the session ID is rotated
+	now := time.Now().Add(time.Hour)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+	rotated, err := cfg.RotateSessionIDIfOlderThan(httptest.NewRecorder(), req, time.Minute)
+	if err != nil || !rotated {
+		t.Fatal("session ID should have been rotated", err)
+		return
+	}
+	v, err = cfg.GetValue(req, "permissions")
+	if err != nil || v != large {
+		t.Fatal("large value should have been moved to the new session ID", err)
+		return
+	}
+	if len(store.values) != 1 {
+		t.Fatal("values for the old session ID should have been deleted", store.values)
+		return
+	}
+
+	//values are deleted when the session is destroyed
+	err = cfg.Destroy(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(store.values) != 0 {
+		t.Fatal("values should have been deleted", store.values)
+		return
+	}
+}
+
+func TestOverflowStoreDelete(t *testing.T) {
+	store := &memoryOverflow{values: make(map[string]map[string]string)}
+
+	cfg := TestConfig()
+	cfg.Overflow = store
+	cfg.OverflowMinBytes = 64
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	err = cfg.AddValue(w, req, "cart.items", strings.Repeat("item,", 50))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	deleted, err := cfg.DeleteValuesByPrefix(w, req, "cart.")
+	if err != nil || deleted != 1 {
+		t.Fatal("overflowed value should have been deleted", deleted, err)
+		return
+	}
+	_, err = cfg.GetValue(req, "cart.items")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+}
+
+func TestOverflowStoreIsEmpty(t *testing.T) {
+	store := &memoryOverflow{values: make(map[string]map[string]string)}
+
+	cfg := TestConfig()
+	cfg.Overflow = store
+	cfg.OverflowMinBytes = 64
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	err = cfg.AddValue(w, req, "items", strings.Repeat("item,", 50))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	empty, err := cfg.IsEmpty(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if empty {
+		t.Fatal("session with an overflowed value should not be empty")
+		return
+	}
+}
+
+func TestOverflowStoreAddMap(t *testing.T) {
+	store := &memoryOverflow{values: make(map[string]map[string]string)}
+
+	cfg := TestConfig()
+	cfg.Overflow = store
+	cfg.OverflowMinBytes = 64
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	err = cfg.AddValue(w, req, "big", strings.Repeat("item,", 50))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	err = cfg.AddMap(w, req, "big", map[string]string{"a": "b"})
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	s, _ := cfg.GetSession(req)
+	keys := userKeys(s)
+	if len(keys) != 1 || keys[0] != "big" {
+		t.Fatal("overflowed value should have been replaced by the map", keys)
+		return
+	}
+	if len(store.values[overflowID(cfg, req)]) != 0 {
+		t.Fatal("overflowed value should have been deleted from the overflow store", store.values)
+		return
+	}
+}
+
+func TestVerifyCodeReplay(t *testing.T) {
+	store := &memoryOverflow{values: make(map[string]map[string]string)}
+
+	cfg := TestConfig()
+	cfg.Overflow = store
+	cfg.CodeAttempts = 2
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	err = cfg.StoreCodeHash(w, req, "otp", "123456")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//replaying the cookie does not restore attempts
+	for i := 0; i < 2; i++ {
+		req = httptest.NewRequest("GET", "/", nil)
+		cfg.AttachCookie(req, encoded)
+		ok, err := cfg.VerifyCode(httptest.NewRecorder(), req, "otp", "000000")
+		if err != nil || ok {
+			t.Fatal("code should not have matched", err)
+			return
+		}
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	_, err = cfg.VerifyCode(httptest.NewRecorder(), req, "otp", "123456")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+
+	//replaying the cookie does not allow a code to be reused
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/", nil)
+	err = cfg.StoreCodeHash(w, req, "otp", "123456")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err = cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	ok, err := cfg.VerifyCode(httptest.NewRecorder(), req, "otp", "123456")
+	if err != nil || !ok {
+		t.Fatal("code should have matched", err)
+		return
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	_, err = cfg.VerifyCode(httptest.NewRecorder(), req, "otp", "123456")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+	if len(store.values) != 0 {
+		t.Fatal("code should have been removed from the overflow store", store.values)
+		return
+	}
+}
+
+func TestCheckRateLimitReplay(t *testing.T) {
+	store := &memoryOverflow{values: make(map[string]map[string]string)}
+
+	cfg := TestConfig()
+	cfg.Overflow = store
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	_, _, err = cfg.CheckRateLimit(w, req, "reset", 2, time.Hour)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//replaying the cookie does not reset the count
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	allowed, _, err := cfg.CheckRateLimit(httptest.NewRecorder(), req, "reset", 2, time.Hour)
+	if err != nil || !allowed {
+		t.Fatal("action should have been allowed", err)
+		return
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	allowed, _, err = cfg.CheckRateLimit(httptest.NewRecorder(), req, "reset", 2, time.Hour)
+	if err != nil || allowed {
+		t.Fatal("action should not have been allowed", err)
+		return
+	}
+}
+
+func TestOverflowStoreWriters(t *testing.T) {
+	store := &memoryOverflow{values: make(map[string]map[string]string)}
+
+	cfg := TestConfig()
+	cfg.Overflow = store
+	cfg.OverflowMinBytes = 64
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	large := strings.Repeat("permission,", 50)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+
+	//overwriting with a small value deletes the entry
+	err = cfg.AddValue(w, req, "permissions", large)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = cfg.AddValue(w, req, "permissions", "none")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(store.values) != 0 {
+		t.Fatal("stale entry should have been deleted", store.values)
+		return
+	}
+
+	//changing the session ID does not orphan entries
+	_, _, err = cfg.SwapValue(w, req, "permissions", large)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = cfg.AddSessionID(w, req, 2554)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	v, err := cfg.GetValue(req, "permissions")
+	if err != nil || v != large {
+		t.Fatal("swapped value should have been stored in the overflow store", err)
+		return
+	}
+
+	//transactions use the overflow store
+	req, tx := cfg.WithSession(req)
+	err = tx.Set("roles", large)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(store.values[overflowID(cfg, req)]) != 2 {
+		t.Fatal("transaction value should have been stored in the overflow store", store.values)
+		return
+	}
+	err = tx.Delete("roles")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(store.values[overflowID(cfg, req)]) != 1 {
+		t.Fatal("deleted transaction value should have been deleted from the overflow store", store.values)
+		return
+	}
+
+	//merged values use the overflow store
+	other := httptest.NewRequest("GET", "/", nil)
+	type cart struct {
+		Items string `session:"items"`
+	}
+	err = cfg.AddStruct(httptest.NewRecorder(), other, cart{Items: large})
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	source, err := cfg.GetSession(other)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = cfg.MergeFrom(w, req, source, false)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	v, err = cfg.GetValue(req, "items")
+	if err != nil || v != large {
+		t.Fatal("merged value should have been read from the overflow store", err)
+		return
+	}
+	if len(store.values[overflowID(cfg, req)]) != 2 {
+		t.Fatal("merged value should have been stored in the overflow store", store.values)
+		return
+	}
+}
+
+//overflowID returns the overflow ID stored in the session for a request.
+func overflowID(c *Config, r *http.Request) string {
+	s, _ := c.GetSession(r)
+	id, _ := s.Values[keyOverflowID].(string)
+	return id
+}
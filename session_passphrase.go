@@ -0,0 +1,49 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines a helper for deriving the auth and encrypt keys from a passphrase rather
+than providing random keys. This is meant for small, low-stakes, deployments where typing
+a memorable passphrase is more convenient than managing keys. Keys derived from a
+passphrase are only as strong as the passphrase, so random keys should be preferred.
+
+The keys are derived using PBKDF2 with HMAC-SHA256 and 600,000 iterations, per OWASP's
+recommendation, producing 96 bytes that are split into the 64 byte auth key and 32 byte
+encrypt key. The same passphrase and salt always result in the same keys, so sessions
+remain valid across restarts and between instances of your app.
+*/
+
+package session
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+)
+
+//passphraseIterations is the number of PBKDF2 iterations used to derive keys.
+const passphraseIterations = 600000
+
+//KeysFromPassphrase derives the auth and encrypt keys from a passphrase and salt and sets
+//them as the AuthKeyBytes and EncryptKeyBytes. The salt should be unique to your app, it
+//does not need to be secret. ErrMissingKey is returned if the passphrase is blank.
+func (c *Config) KeysFromPassphrase(passphrase, salt string) (err error) {
+	if passphrase == "" {
+		return ErrMissingKey
+	}
+
+	key, err := pbkdf2.Key(sha256.New, passphrase, []byte(salt), passphraseIterations, authKeyLength+encryptKeyLength)
+	if err != nil {
+		return
+	}
+
+	c.AuthKeyBytes = key[:authKeyLength]
+	c.EncryptKeyBytes = key[authKeyLength:]
+	return
+}
+
+//KeysFromPassphrase derives the auth and encrypt keys from a passphrase and salt and sets
+//them on the package level config.
+func KeysFromPassphrase(passphrase, salt string) (err error) {
+	checkSealed("KeysFromPassphrase")
+	return config.KeysFromPassphrase(passphrase, salt)
+}
@@ -0,0 +1,81 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines a simple per-session rate limiter. This is useful for limiting how
+often a user can perform an action, for example requesting a password reset.
+
+The count is kept in the Overflow store when one is set. Otherwise it is kept in the cookie
+and a client can replay an earlier cookie to reset the count, so the limit is advisory only.
+Even with an Overflow store, a client can start a new session by not sending a cookie at
+all. This is not a security control; limit sensitive actions by user or IP address instead.
+*/
+
+package session
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//keyPrefixRateLimit is prepended to the key provided to CheckRateLimit. The value stored
+//is the unix timestamp the window started at and the count of actions in the window,
+//separated by a comma.
+const keyPrefixRateLimit = keyPrefixInternal + "ratelimit:"
+
+//CheckRateLimit counts an action against a limit within a time window. If the action is
+//allowed, the count is incremented, the session is saved, and the number of actions
+//remaining in the window is returned. If the limit has already been reached, allowed is
+//false and the count is not incremented. The count resets once the window has elapsed
+//since the first action in the window.
+//
+//The limit is advisory only, see the file comment.
+func (c *Config) CheckRateLimit(w http.ResponseWriter, r *http.Request, key string, limit int, window time.Duration) (allowed bool, remaining int, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	now := nowFunc()
+	start, count := now, 0
+
+	k := keyPrefixRateLimit + key
+	v, exists, err := c.internalValue(s, k)
+	if err != nil {
+		return
+	}
+	if exists {
+		parts := strings.SplitN(v, ",", 2)
+		if len(parts) == 2 {
+			unix, uErr := strconv.ParseInt(parts[0], 10, 64)
+			n, nErr := strconv.Atoi(parts[1])
+			if uErr == nil && nErr == nil && now.Sub(time.Unix(unix, 0)) < window {
+				start, count = time.Unix(unix, 0), n
+			}
+		}
+	}
+
+	if count >= limit {
+		return false, 0, nil
+	}
+
+	count++
+	err = c.setInternalValue(s, k, strconv.FormatInt(start.Unix(), 10)+","+strconv.Itoa(count))
+	if err != nil {
+		return
+	}
+
+	err = c.save(w, r, s)
+	if err != nil {
+		return
+	}
+
+	return true, limit - count, nil
+}
+
+//CheckRateLimit counts an action against a limit using the default package level config.
+func CheckRateLimit(w http.ResponseWriter, r *http.Request, key string, limit int, window time.Duration) (allowed bool, remaining int, err error) {
+	return config.CheckRateLimit(w, r, key, limit, window)
+}
@@ -0,0 +1,79 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines a read-only wrapper around a session for use in handlers that should
+only ever read from a session, never modify it.
+*/
+
+package session
+
+import (
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+//ReadOnlySession wraps a session and only exposes methods for reading values. Use this
+//in handlers that only need to read from a session to make it clear, and enforced, that
+//the session is not modified or saved.
+type ReadOnlySession struct {
+	c *Config
+	s *sessions.Session
+}
+
+//ReadOnly returns a read-only wrapper around the session for a request.
+func (c *Config) ReadOnly(r *http.Request) (*ReadOnlySession, error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReadOnlySession{c: c, s: s}, nil
+}
+
+//ReadOnly returns a read-only wrapper around the session using the default package level config.
+func ReadOnly(r *http.Request) (*ReadOnlySession, error) {
+	return config.ReadOnly(r)
+}
+
+//GetValue returns the value stored for a key, of whatever type it was stored as. String
+//values are returned the same as GetString returns them. ErrKeyNotFound is returned if the
+//key does not exist.
+func (ro *ReadOnlySession) GetValue(key string) (value interface{}, err error) {
+	str, exists, err := ro.c.lookupValue(ro.s, ro.c.normalizeKey(key))
+	if err == ErrWrongType {
+		return ro.s.Values[ro.c.normalizeKey(key)], nil
+	}
+	if err != nil {
+		return
+	}
+	if !exists {
+		return nil, ErrKeyNotFound
+	}
+
+	return str, nil
+}
+
+//GetString returns the string value stored for a key. ErrKeyNotFound is returned if the
+//key does not exist and ErrWrongType is returned if the value stored isn't a string.
+func (ro *ReadOnlySession) GetString(key string) (value string, err error) {
+	raw, err := ro.GetValue(key)
+	if err != nil {
+		return
+	}
+
+	value, ok := raw.(string)
+	if !ok {
+		return "", ErrWrongType
+	}
+
+	return
+}
+
+//HasValue returns true if a value is stored for the key and it can be read. False is
+//returned if the value could not be read, for example from the Overflow store.
+func (ro *ReadOnlySession) HasValue(key string) bool {
+	_, err := ro.GetValue(key)
+	return err == nil
+}
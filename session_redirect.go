@@ -0,0 +1,98 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines helper functions for storing the URL a user was trying to reach before
+being sent to log in, so they can be redirected back after logging in. Only local paths
+are allowed, the URL is checked when stored and again when retrieved, to prevent the
+return URL from being used as an open redirect to another site.
+*/
+
+package session
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//keyReturnURL is the key in the session the return URL is stored under.
+const keyReturnURL = keyPrefixInternal + "return_url"
+
+//SetReturnURL stores the URL to redirect to after logging in. ErrInvalidReturnURL is
+//returned if the URL is not a local path, such as "/account?tab=billing".
+func (c *Config) SetReturnURL(w http.ResponseWriter, r *http.Request, u string) (err error) {
+	if !validReturnURL(u) {
+		return ErrInvalidReturnURL
+	}
+
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	s.Values[keyReturnURL] = u
+
+	err = c.save(w, r, s)
+	return
+}
+
+//SetReturnURL stores the URL to redirect to after logging in using the default package level
+//config.
+func SetReturnURL(w http.ResponseWriter, r *http.Request, u string) (err error) {
+	return config.SetReturnURL(w, r, u)
+}
+
+//PopReturnURL returns the URL stored with SetReturnURL and removes it from the session. The
+//fallback is returned if no URL is stored or the stored URL is not a local path.
+func (c *Config) PopReturnURL(w http.ResponseWriter, r *http.Request, fallback string) (u string, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	stored, exists := s.Values[keyReturnURL]
+	if !exists {
+		return fallback, nil
+	}
+
+	delete(s.Values, keyReturnURL)
+	err = c.save(w, r, s)
+	if err != nil {
+		return
+	}
+
+	u, _ = stored.(string)
+	if !validReturnURL(u) {
+		return fallback, nil
+	}
+
+	return
+}
+
+//PopReturnURL returns and removes the URL stored with SetReturnURL using the default package
+//level config.
+func PopReturnURL(w http.ResponseWriter, r *http.Request, fallback string) (u string, err error) {
+	return config.PopReturnURL(w, r, fallback)
+}
+
+//validReturnURL checks that a URL is a local path. Protocol relative URLs ("//example.com")
+//and backslashes, which some browsers treat as slashes, are rejected.
+func validReturnURL(u string) bool {
+	if !strings.HasPrefix(u, "/") || strings.HasPrefix(u, "//") || strings.Contains(u, "\\") {
+		return false
+	}
+
+	for _, r := range u {
+		if r < 0x20 || r == 0x7f {
+			return false
+		}
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+
+	return parsed.Scheme == "" && parsed.Host == ""
+}
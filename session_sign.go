@@ -0,0 +1,48 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines helper functions for signing strings using the same auth key the
+session cookie is signed with. This is useful for small tamper-evident values passed
+outside of the session, such as a short-lived download link token.
+*/
+
+package session
+
+import (
+	"github.com/gorilla/securecookie"
+)
+
+//signedName is the name used when signing strings. The name is included in the signature
+//so signed strings cannot be used as session cookies and vice versa.
+const signedName = "session_signed_string"
+
+//signer returns a codec that signs, but does not encrypt, values using the auth key.
+func (c *Config) signer() *securecookie.SecureCookie {
+	authKey, _ := c.keys()
+	return securecookie.New(authKey, nil)
+}
+
+//SignString signs a string using the config's auth key. The returned value includes the
+//original string and can be checked with VerifyString. Note that the string is not
+//encrypted, only signed. Init must be called first so that an auth key is set.
+func (c *Config) SignString(s string) (signed string, err error) {
+	return c.signer().Encode(signedName, s)
+}
+
+//SignString signs a string using the default package level config.
+func SignString(s string) (signed string, err error) {
+	return config.SignString(s)
+}
+
+//VerifyString checks a string signed with SignString and returns the original string. An
+//error is returned if the signature is invalid or the signed string has expired.
+func (c *Config) VerifyString(signed string) (s string, err error) {
+	err = c.signer().Decode(signedName, signed, &s)
+	return
+}
+
+//VerifyString checks a signed string using the default package level config.
+func VerifyString(signed string) (s string, err error) {
+	return config.VerifyString(signed)
+}
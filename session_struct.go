@@ -0,0 +1,194 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines helper functions for storing the fields of a struct in a session and
+reading them back. Fields are mapped to session keys using the "session" struct tag, for
+example `session:"user_id"`, and each field is stored as a string so the values can be
+read with GetValue as well. Fields without a tag, tagged "-", or unexported are ignored.
+
+Supported field types are strings, ints, uints, floats, bools, and time.Time. Times are
+stored as unix seconds, the same as other times this package stores.
+*/
+
+package session
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+//structTag is the struct tag used to map fields to session keys.
+const structTag = "session"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+//AddStruct stores each tagged field of v in the session with one save. v must be a struct
+//or a pointer to a struct.
+func (c *Config) AddStruct(w http.ResponseWriter, r *http.Request, v interface{}) (err error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return ErrUnsupportedField
+	}
+
+	//build the values first so nothing is stored if a field can't be converted
+	kv := make(map[string]string)
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		key := field.Tag.Get(structTag)
+		if key == "" || key == "-" || !field.IsExported() {
+			continue
+		}
+
+		key = c.normalizeKey(key)
+		if isInternalKey(key) {
+			return ErrReservedKey
+		}
+
+		str, err := fieldToString(rv.Field(i))
+		if err != nil {
+			return err
+		}
+
+		err = c.validValue(str)
+		if err != nil {
+			return err
+		}
+		kv[key] = str
+	}
+
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	for k, v := range kv {
+		err = c.setValue(s, k, v)
+		if err != nil {
+			return
+		}
+	}
+
+	err = c.save(w, r, s)
+	return
+}
+
+//AddStruct stores each tagged field of v in the session using the default package level config.
+func AddStruct(w http.ResponseWriter, r *http.Request, v interface{}) (err error) {
+	return config.AddStruct(w, r, v)
+}
+
+//GetStruct populates each tagged field of dest from the session. dest must be a pointer to
+//a struct. Fields whose key is not in the session are left unchanged.
+func (c *Config) GetStruct(r *http.Request, dest interface{}) (err error) {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return ErrUnsupportedField
+	}
+	rv = rv.Elem()
+
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		key := field.Tag.Get(structTag)
+		if key == "" || key == "-" || !field.IsExported() {
+			continue
+		}
+
+		str, exists, lErr := c.lookupValue(s, c.normalizeKey(key))
+		if lErr != nil {
+			return lErr
+		}
+		if !exists {
+			continue
+		}
+
+		err = stringToField(str, rv.Field(i))
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+//GetStruct populates each tagged field of dest from the session using the default package
+//level config.
+func GetStruct(r *http.Request, dest interface{}) (err error) {
+	return config.GetStruct(r, dest)
+}
+
+//fieldToString converts a struct field's value to the string stored in the session.
+func fieldToString(f reflect.Value) (str string, err error) {
+	if f.Type() == timeType {
+		return strconv.FormatInt(f.Interface().(time.Time).Unix(), 10), nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		return f.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(f.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(f.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(f.Float(), 'g', -1, 64), nil
+	case reflect.Bool:
+		return strconv.FormatBool(f.Bool()), nil
+	}
+
+	return "", ErrUnsupportedField
+}
+
+//stringToField parses a string stored in the session and sets the struct field to it.
+func stringToField(str string, f reflect.Value) (err error) {
+	if f.Type() == timeType {
+		unix, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return ErrWrongType
+		}
+		f.Set(reflect.ValueOf(time.Unix(unix, 0)))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(str)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(str, 10, f.Type().Bits())
+		if err != nil {
+			return ErrWrongType
+		}
+		f.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(str, 10, f.Type().Bits())
+		if err != nil {
+			return ErrWrongType
+		}
+		f.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		fl, err := strconv.ParseFloat(str, f.Type().Bits())
+		if err != nil {
+			return ErrWrongType
+		}
+		f.SetFloat(fl)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return ErrWrongType
+		}
+		f.SetBool(b)
+	default:
+		return ErrUnsupportedField
+	}
+
+	return
+}
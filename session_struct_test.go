@@ -0,0 +1,124 @@
+package session
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type structTestUser struct {
+	UserID   int64     `session:"user_id"`
+	Username string    `session:"username"`
+	Admin    bool      `session:"admin"`
+	LoggedIn time.Time `session:"logged_in"`
+	Ignored  string
+}
+
+func TestAddGetStruct(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	in := structTestUser{
+		UserID:   42,
+		Username: "alice",
+		Admin:    true,
+		LoggedIn: time.Unix(1700000000, 0),
+		Ignored:  "ignored",
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddStruct(w, req, &in)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	v, err := cfg.GetValue(req, "user_id")
+	if err != nil || v != "42" {
+		t.Fatal("field not stored as string", v, err)
+		return
+	}
+
+	var out structTestUser
+	err = cfg.GetStruct(req, &out)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if out.UserID != in.UserID || out.Username != in.Username || !out.Admin || !out.LoggedIn.Equal(in.LoggedIn) {
+		t.Fatal("struct not populated correctly", out)
+		return
+	}
+	if out.Ignored != "" {
+		t.Fatal("untagged field should not be populated")
+		return
+	}
+
+	//not a pointer
+	err = cfg.GetStruct(req, out)
+	if err != ErrUnsupportedField {
+		t.Fatal("ErrUnsupportedField should have occured but didn't", err)
+		return
+	}
+}
+
+type structTestUnexported struct {
+	Username string    `session:"username"`
+	created  time.Time `session:"created"`
+	admin    bool      `session:"admin"`
+}
+
+func TestStructUnexportedFields(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	in := structTestUnexported{
+		Username: "alice",
+		created:  time.Unix(1700000000, 0),
+		admin:    true,
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddStruct(w, req, &in)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	_, err = cfg.GetValue(req, "created")
+	if err == nil {
+		t.Fatal("unexported field should not be stored")
+		return
+	}
+
+	err = cfg.AddValue(w, req, "admin", "true")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	var out structTestUnexported
+	err = cfg.GetStruct(req, &out)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if out.Username != in.Username {
+		t.Fatal("exported field not populated", out)
+		return
+	}
+	if out.admin {
+		t.Fatal("unexported field should not be populated")
+		return
+	}
+}
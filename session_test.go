@@ -1,10 +1,19 @@
 package session
 
 import (
+	"encoding/base64"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+	"unsafe"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
 )
 
 func TestNewConfig(t *testing.T) {
@@ -85,6 +94,19 @@ func TestValidate(t *testing.T) {
 	}
 	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
 
+	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+	//Check for invalid paths.
+	for _, p := range []string{"no/leading/slash", "/semi;colon", "/control\n"} {
+		cfg = NewConfig()
+		cfg.Path = p
+		err = cfg.validate()
+		if err != ErrInvalidPath {
+			t.Fatal("ErrInvalidPath should have occured but didn't", p, err)
+			return
+		}
+	}
+	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
 	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
 	//Make sure a max age must be set.
 	cfg = NewConfig()
@@ -353,6 +375,68 @@ func TestGetAllValues(t *testing.T) {
 	}
 }
 
+func TestInitOnce(t *testing.T) {
+	saved := config
+	defer func() {
+		config = saved
+		initializedOnce = false
+	}()
+	initializedOnce = false
+
+	//a failed init leaves the config unchanged and can be retried
+	invalid := TestConfig()
+	invalid.Path = "invalid"
+	err := InitOnce(invalid)
+	if err != ErrInvalidPath {
+		t.Fatal("ErrInvalidPath should have occured but didn't", err)
+		return
+	}
+	if config.CookieName != saved.CookieName {
+		t.Fatal("package level config should not have been replaced", config.CookieName)
+		return
+	}
+
+	first := TestConfig()
+	first.CookieName = "first"
+	err = InitOnce(first)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	second := NewConfig()
+	second.CookieName = "second"
+	err = InitOnce(second)
+	if err != ErrAlreadyInitialized {
+		t.Fatal("ErrAlreadyInitialized should have occured but didn't", err)
+		return
+	}
+	if config.CookieName != "first" {
+		t.Fatal("package level config should not have been replaced", config.CookieName)
+		return
+	}
+
+	//package level Init and DefaultConfig cannot replace the config either
+	err = Init()
+	if err != ErrAlreadyInitialized {
+		t.Fatal("ErrAlreadyInitialized should have occured but didn't", err)
+		return
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("DefaultConfig should have panicked")
+			}
+		}()
+		DefaultConfig()
+	}()
+	if config.CookieName != "first" {
+		t.Fatal("package level config should not have been replaced", config.CookieName)
+		return
+	}
+}
+
 func TestDefaultConfig(t *testing.T) {
 	DefaultConfig()
 
@@ -471,3 +555,4023 @@ func TestDefaultConfig(t *testing.T) {
 	}
 
 }
+
+func TestDomainAuto(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Domain = DomainAuto
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+	//Subdomain should resolve to the registrable domain.
+	req := httptest.NewRequest("GET", "http://app.example.com:8080/", nil)
+	if d := cfg.domainFor(req); d != "example.com" {
+		t.Fatal("Domain not derived from host as expected", d)
+		return
+	}
+	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+	//IP addresses should result in a host-only cookie.
+	req = httptest.NewRequest("GET", "http://127.0.0.1/", nil)
+	if d := cfg.domainFor(req); d != "" {
+		t.Fatal("Domain should be blank for IP address hosts", d)
+		return
+	}
+	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+	//Cookie should be set with derived domain.
+	req = httptest.NewRequest("GET", "http://app.example.com/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Domain != "example.com" {
+		t.Fatal("Cookie domain not set as expected")
+		return
+	}
+	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+}
+
+func TestTestConfig(t *testing.T) {
+	cfg := TestConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//add value with one config
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//read value with another config, keys should match so cookie can be decoded
+	cfg2 := TestConfig()
+	err = cfg2.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req2 := httptest.NewRequest("GET", "/", nil)
+	cfg2.AttachCookie(req2, encoded)
+
+	v, err := cfg2.GetValue(req2, "key")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if v != "value" {
+		t.Fatal("value not retrieved")
+		return
+	}
+}
+
+func TestRotateToken(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	//no token stored yet
+	_, err = cfg.RotateToken(w, req, "new")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+
+	err = cfg.AddToken(w, req, "old")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	old, err := cfg.RotateToken(w, req, "new")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if old != "old" {
+		t.Fatal("previous token not returned")
+		return
+	}
+
+	tok, err := cfg.GetToken(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if tok != "new" {
+		t.Fatal("token not rotated")
+		return
+	}
+}
+
+func TestSetRandSource(t *testing.T) {
+	defer SetRandSource(nil)
+
+	//a fixed source should result in fixed keys
+	SetRandSource(strings.NewReader(strings.Repeat("a", authKeyLength+encryptKeyLength)))
+	cfg := NewConfig()
+	err := cfg.validate()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if cfg.AuthKey != strings.Repeat("a", authKeyLength) {
+		t.Fatal("AuthKey not generated from provided source")
+		return
+	}
+	if cfg.EncryptKey != strings.Repeat("a", encryptKeyLength) {
+		t.Fatal("EncryptKey not generated from provided source")
+		return
+	}
+
+	//an exhausted source should return an error
+	cfg = NewConfig()
+	err = cfg.validate()
+	if err == nil {
+		t.Fatal("Error should have occured but didn't")
+		return
+	}
+}
+
+func TestResetToAuth(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	err = cfg.AddUsername(w, req, "user")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = cfg.AddValue(w, req, "cart", "1234")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	err = cfg.ResetToAuth(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	username, err := cfg.GetUsername(req)
+	if err != nil || username != "user" {
+		t.Fatal("username should have been retained", err)
+		return
+	}
+
+	_, err = cfg.GetValue(req, "cart")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+}
+
+func TestResetToAuthKeepsTokenExpiry(t *testing.T) {
+	now := time.Now()
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddTokenWithExpiry(w, req, "token", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	err = cfg.ResetToAuth(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	now = now.Add(2 * time.Hour)
+	_, err = cfg.GetValidToken(req)
+	if err != ErrTokenExpired {
+		t.Fatal("ErrTokenExpired should have occured but didn't", err)
+		return
+	}
+}
+
+func TestPriority(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Priority = "Urgent"
+	err := cfg.Init()
+	if err != ErrInvalidPriority {
+		t.Fatal("ErrInvalidPriority should have occured but didn't", err)
+		return
+	}
+
+	cfg = NewConfig()
+	cfg.Priority = "High"
+	err = cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	header := w.Header().Get("Set-Cookie")
+	if !strings.HasSuffix(header, "; Priority=High") {
+		t.Fatal("Priority attribute not set", header)
+		return
+	}
+
+	//every other cookie gets the attribute too
+	cfg.RegisterCompanionCookie("remember_me")
+	req.AddCookie(&http.Cookie{Name: "remember_me", Value: "1"})
+	w = httptest.NewRecorder()
+	_, err = cfg.IssueCSRFCookie(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = cfg.CheckFingerprint(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = cfg.Destroy(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	names := make(map[string]bool)
+	for _, header := range w.Header()["Set-Cookie"] {
+		names[strings.SplitN(header, "=", 2)[0]] = true
+		if !strings.HasSuffix(header, "; Priority=High") {
+			t.Fatal("Priority attribute not set", header)
+			return
+		}
+	}
+	if !names[cfg.csrfCookieName()] || !names[cfg.fingerprintCookieName()] || !names["remember_me"] {
+		t.Fatal("cookies not set", names)
+		return
+	}
+}
+
+func TestGetAllValuesTyped(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	cfg.AddValue(w, req, "int", "25")
+	cfg.AddValue(w, req, "bool", "true")
+	cfg.AddValue(w, req, "string", "hello")
+
+	values, err := cfg.GetAllValuesTyped(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if v, ok := values["int"].(int64); !ok || v != 25 {
+		t.Fatal("int value not converted", values["int"])
+		return
+	}
+	if v, ok := values["bool"].(bool); !ok || !v {
+		t.Fatal("bool value not converted", values["bool"])
+		return
+	}
+	if v, ok := values["string"].(string); !ok || v != "hello" {
+		t.Fatal("string value not retained", values["string"])
+		return
+	}
+}
+
+func TestSeal(t *testing.T) {
+	DefaultConfig()
+	err := Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//setting a field after Init should panic
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Setting field on sealed config should have panicked")
+			}
+		}()
+		Secure(true)
+	}()
+
+	//after unsealing, setting a field should work
+	Unseal()
+	Secure(true)
+	if !GetConfig().Secure {
+		t.Fatal("Secure field not set correctly")
+		return
+	}
+}
+
+func TestRejectWeakKeys(t *testing.T) {
+	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+	//Weak keys are allowed by default.
+	cfg := NewConfig()
+	cfg.AuthKey = strings.Repeat("asdf", 16)
+	err := cfg.validate()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+	//Weak auth key is rejected when enabled.
+	cfg = NewConfig()
+	cfg.RejectWeakKeys = true
+	cfg.AuthKey = strings.Repeat("asdf", 16)
+	err = cfg.validate()
+	if err != ErrWeakKey {
+		t.Fatal("ErrWeakKey should have occured but didn't", err)
+		return
+	}
+	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+	//Weak encrypt key built from a longer pattern is rejected when enabled.
+	cfg = NewConfig()
+	cfg.RejectWeakKeys = true
+	cfg.EncryptKey = strings.Repeat("abcdefgh", 4)
+	err = cfg.validate()
+	if err != ErrWeakKey {
+		t.Fatal("ErrWeakKey should have occured but didn't", err)
+		return
+	}
+	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+	//Hex encoded random keys are not rejected.
+	cfg = NewConfig()
+	cfg.RejectWeakKeys = true
+	cfg.AuthKey = "6f1c2a9be4d07385c1fa0e92b7d46c3a58e01f9d2c7b4a6035e8d1f97ab2c640"
+	cfg.EncryptKey = "9d3e7a1c05b84f62e1a9c7d30b5f8e24"
+	err = cfg.validate()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+}
+
+func TestMigrateFrom(t *testing.T) {
+	cfg := NewConfig()
+	cfg.MigrateFrom = func(r *http.Request) (map[string]string, error) {
+		c, err := r.Cookie("legacy")
+		if err != nil {
+			return nil, nil
+		}
+		return map[string]string{"username": c.Value}, nil
+	}
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//request with legacy cookie gets migrated values
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "legacy", Value: "user"})
+	username, err := cfg.GetUsername(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if username != "user" {
+		t.Fatal("value not migrated")
+		return
+	}
+
+	//request without legacy cookie is just a new session
+	req = httptest.NewRequest("GET", "/", nil)
+	s, err := cfg.GetSession(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if !s.IsNew || len(s.Values) != 0 {
+		t.Fatal("session should be new and empty")
+		return
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	empty, err := cfg.IsEmpty(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if !empty {
+		t.Fatal("new session should be empty")
+		return
+	}
+
+	//internal values should be ignored
+	_, err = cfg.IssueCSRFCookie(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	empty, _ = cfg.IsEmpty(req)
+	if !empty {
+		t.Fatal("session with only internal values should be empty")
+		return
+	}
+
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	empty, _ = cfg.IsEmpty(req)
+	if empty {
+		t.Fatal("session with values should not be empty")
+		return
+	}
+}
+
+func TestGetValues(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	cfg.AddValue(w, req, "one", "1")
+	cfg.AddValue(w, req, "two", "2")
+	cfg.AddValue(w, req, "three", "3")
+
+	values, err := cfg.GetValues(req, "one", "three", "missing")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(values) != 2 || values["one"] != "1" || values["three"] != "3" {
+		t.Fatal("incorrect values returned", values)
+		return
+	}
+}
+
+func TestKeysBytes(t *testing.T) {
+	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+	//Check if auth key is incorrect length.
+	cfg := NewConfig()
+	cfg.AuthKeyBytes = []byte("too short")
+	err := cfg.validate()
+	if err != ErrAuthKeyWrongSize {
+		t.Fatal("ErrAuthKeyWrongSize should have occured but didnt", err)
+		return
+	}
+	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+	//Check if encrypt key is incorrect length.
+	cfg = NewConfig()
+	cfg.EncryptKeyBytes = make([]byte, 20)
+	err = cfg.validate()
+	if err != ErrEncyptKeyWrongSize {
+		t.Fatal("ErrEncyptKeyWrongSize should have occured but didnt", err)
+		return
+	}
+	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+	//Binary keys, including a 16 byte encrypt key, are usable.
+	authKey := make([]byte, authKeyLength)
+	encryptKey := make([]byte, 16)
+	for i := range authKey {
+		authKey[i] = byte(255 - i)
+	}
+	for i := range encryptKey {
+		encryptKey[i] = byte(200 + i)
+	}
+
+	cfg = NewConfig()
+	cfg.AuthKeyBytes = authKey
+	cfg.EncryptKeyBytes = encryptKey
+	err = cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+}
+
+func TestGetCreatedAt(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	//session not saved yet
+	_, err = cfg.GetCreatedAt(req)
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	created, err := cfg.GetCreatedAt(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if time.Since(created) > time.Minute {
+		t.Fatal("created at time not set correctly", created)
+		return
+	}
+
+	//created at should not show up as a user value
+	values, _ := cfg.GetAllValues(req)
+	if _, exists := values[keyCreatedAt]; exists {
+		t.Fatal("created at should not be returned with user values")
+		return
+	}
+}
+
+func TestGetValueWrongType(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	s, err := cfg.GetSession(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	s.Values["int"] = 10
+
+	_, err = cfg.GetValue(req, "int")
+	if err != ErrWrongType {
+		t.Fatal("ErrWrongType should have occured but didn't", err)
+		return
+	}
+}
+
+func TestDomains(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Domain = "fallback.com"
+	cfg.Domains = []string{"example.com", "app.example.com", "example.org"}
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	tests := map[string]string{
+		"http://example.org/":          "example.org",
+		"http://www.example.com/":      "example.com",
+		"http://eu.app.example.com/":   "app.example.com",
+		"http://notexample.com/":       "fallback.com",
+		"http://another.net:8080/path": "fallback.com",
+	}
+	for url, expected := range tests {
+		req := httptest.NewRequest("GET", url, nil)
+		if d := cfg.domainFor(req); d != expected {
+			t.Fatal("Domain not chosen correctly", url, d)
+			return
+		}
+	}
+}
+
+func TestReadOnlyHasValueError(t *testing.T) {
+	cfg := NewConfig()
+	cfg.ValueDecoder = func(key, value string) (string, error) {
+		return "", errors.New("decode failed")
+	}
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	ro, err := cfg.ReadOnly(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if ro.HasValue("key") {
+		t.Fatal("HasValue should be false if the value can't be read")
+		return
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	ro, err := cfg.ReadOnly(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	if !ro.HasValue("key") || ro.HasValue("missing") {
+		t.Fatal("HasValue returned incorrect result")
+		return
+	}
+
+	v, err := ro.GetString("key")
+	if err != nil || v != "value" {
+		t.Fatal("value not retrieved", err)
+		return
+	}
+
+	_, err = ro.GetValue("missing")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+}
+
+func TestOnConflict(t *testing.T) {
+	conflicts := 0
+	cfg := NewConfig()
+	cfg.OnConflict = func(r *http.Request, s *sessions.Session) error {
+		conflicts++
+		return nil
+	}
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//create the session
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	cookies := w.Result().Cookies()
+
+	//two tabs send the same cookie, the second save should conflict
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		err = cfg.AddValue(httptest.NewRecorder(), req, "tab", strconv.Itoa(i))
+		if err != nil {
+			t.Fatal("Error occured but should not have", err)
+			return
+		}
+	}
+
+	if conflicts != 1 {
+		t.Fatal("conflict not detected", conflicts)
+		return
+	}
+}
+
+func TestVersionTrackerLimit(t *testing.T) {
+	vt := newVersionTracker(2)
+	vt.set("a", 1)
+	vt.set("b", 1)
+	vt.set("c", 1)
+	if vt.get("a") != 0 || vt.get("b") != 1 || vt.get("c") != 1 {
+		t.Fatal("session saved least recently should have been evicted")
+		return
+	}
+
+	//saving a session again keeps it tracked
+	vt.set("b", 2)
+	vt.set("d", 1)
+	if vt.get("b") != 2 || vt.get("c") != 0 || vt.get("d") != 1 {
+		t.Fatal("session saved least recently should have been evicted")
+		return
+	}
+
+	vt.remove("b")
+	if vt.get("b") != 0 || len(vt.latest) != 1 || vt.order.Len() != 1 {
+		t.Fatal("session should have been removed")
+		return
+	}
+}
+func TestSaveWithLifetime(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.SaveWithLifetime(w, req, 7*24*time.Hour)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//extending should use the per-session lifetime
+	w = httptest.NewRecorder()
+	err = cfg.Extend(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge != int((7*24*time.Hour).Seconds()) {
+		t.Fatal("per-session lifetime not used")
+		return
+	}
+}
+
+func TestExtractCookie(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//nothing set yet
+	w := httptest.NewRecorder()
+	_, err = cfg.ExtractCookie(w)
+	if err != ErrNoCookie {
+		t.Fatal("ErrNoCookie should have occured but didn't", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req2 := httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req2, encoded)
+	s, err := cfg.GetSession(req2)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if s.IsNew {
+		t.Fatal("session should have been decoded from attached cookie")
+		return
+	}
+}
+
+func TestAddTokenWithExpiry(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	//expiration in the past isn't allowed
+	err = cfg.AddTokenWithExpiry(w, req, "token", time.Now().Add(-time.Minute))
+	if err != ErrMaxAgeTooShort {
+		t.Fatal("ErrMaxAgeTooShort should have occured but didn't", err)
+		return
+	}
+
+	err = cfg.AddTokenWithExpiry(w, req, "token", time.Now().Add(10*time.Minute))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge > 600 || cookies[0].MaxAge < 590 {
+		t.Fatal("cookie expiration not matched to token")
+		return
+	}
+}
+
+func TestFallbackCookieNames(t *testing.T) {
+	//issue a cookie under the old name
+	old := TestConfig()
+	old.CookieName = "old_session"
+	err := old.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = old.AddUsername(w, req, "user")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, _ := old.ExtractCookie(w)
+
+	//read it with the new name
+	cfg := TestConfig()
+	cfg.FallbackCookieNames = []string{"old_session"}
+	err = cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	old.AttachCookie(req, encoded)
+	username, err := cfg.GetUsername(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if username != "user" {
+		t.Fatal("value not read from fallback cookie")
+		return
+	}
+
+	//saving should issue the new cookie and expire the old
+	w = httptest.NewRecorder()
+	err = cfg.Extend(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	var issued, expired bool
+	for _, c := range w.Result().Cookies() {
+		if c.Name == cfg.CookieName && c.MaxAge > 0 {
+			issued = true
+		}
+		if c.Name == "old_session" && c.MaxAge < 0 {
+			expired = true
+		}
+	}
+	if !issued || !expired {
+		t.Fatal("cookie not migrated to new name", issued, expired)
+		return
+	}
+}
+
+func TestEffectiveOptions(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SameSite = 0
+	cfg.Path = ""
+
+	ops := cfg.EffectiveOptions()
+	if ops.SameSite != defaultSameSite {
+		t.Fatal("SameSite default not applied", ops.SameSite)
+		return
+	}
+	if ops.Path != defaultPath {
+		t.Fatal("Path default not applied", ops.Path)
+		return
+	}
+
+	//config itself should not be modified
+	if cfg.SameSite != 0 || cfg.Path != "" {
+		t.Fatal("config should not have been modified")
+		return
+	}
+}
+
+func TestCheckRateLimit(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	for i := 2; i >= 0; i-- {
+		allowed, remaining, err := cfg.CheckRateLimit(w, req, "reset", 3, time.Hour)
+		if err != nil {
+			t.Fatal("Error occured but should not have", err)
+			return
+		}
+		if !allowed || remaining != i {
+			t.Fatal("action should have been allowed", allowed, remaining)
+			return
+		}
+	}
+
+	allowed, _, err := cfg.CheckRateLimit(w, req, "reset", 3, time.Hour)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if allowed {
+		t.Fatal("action should not have been allowed")
+		return
+	}
+
+	//window elapsed, count is reset
+	s, _ := cfg.GetSession(req)
+	s.Values[keyPrefixRateLimit+"reset"] = strconv.FormatInt(time.Now().Add(-2*time.Hour).Unix(), 10) + ",3"
+	allowed, remaining, err := cfg.CheckRateLimit(w, req, "reset", 3, time.Hour)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if !allowed || remaining != 2 {
+		t.Fatal("count should have been reset", allowed, remaining)
+		return
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	cfg := TestConfig()
+	cfg.Defaults = map[string]string{"locale": "en", "theme": "light"}
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//new session gets defaults
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	locale, err := cfg.GetValue(req, "locale")
+	if err != nil || locale != "en" {
+		t.Fatal("default not applied", err)
+		return
+	}
+
+	err = cfg.AddValue(w, req, "theme", "dark")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//existing session keeps its values
+	encoded, _ := cfg.ExtractCookie(w)
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	theme, err := cfg.GetValue(req, "theme")
+	if err != nil || theme != "dark" {
+		t.Fatal("existing value overwritten by default", err, theme)
+		return
+	}
+}
+
+func TestVerifyCookie(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//missing cookie
+	req := httptest.NewRequest("GET", "/", nil)
+	valid, err := cfg.VerifyCookie(req)
+	if valid || err != ErrNoCookie {
+		t.Fatal("ErrNoCookie should have occured but didn't", err)
+		return
+	}
+
+	//tampered cookie
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, "tampered")
+	valid, err = cfg.VerifyCookie(req)
+	if valid || err == nil || err == ErrNoCookie {
+		t.Fatal("decode error should have occured but didn't", err)
+		return
+	}
+
+	//good cookie
+	w := httptest.NewRecorder()
+	cfg.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	encoded, _ := cfg.ExtractCookie(w)
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	valid, err = cfg.VerifyCookie(req)
+	if !valid || err != nil {
+		t.Fatal("cookie should have been valid", err)
+		return
+	}
+}
+
+func TestExtendExisting(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//new session shouldn't be saved
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.ExtendExisting(w, req)
+	if err != ErrNoSession {
+		t.Fatal("ErrNoSession should have occured but didn't", err)
+		return
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Fatal("cookie should not have been set")
+		return
+	}
+
+	//existing session is extended
+	w = httptest.NewRecorder()
+	cfg.AddValue(w, req, "key", "value")
+	encoded, _ := cfg.ExtractCookie(w)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	w = httptest.NewRecorder()
+	err = cfg.ExtendExisting(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if _, err := cfg.ExtractCookie(w); err != nil {
+		t.Fatal("cookie should have been set", err)
+		return
+	}
+}
+
+func TestSessionIdentifier(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	id, err := cfg.SessionIdentifier(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if id == "" {
+		t.Fatal("no identifier generated")
+		return
+	}
+
+	id2, err := cfg.SessionIdentifier(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if id2 != id {
+		t.Fatal("identifier not stable", id, id2)
+		return
+	}
+}
+
+func TestHashedMarker(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	_, err = cfg.VerifyMarker(req, "pw_epoch", "1700000000")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+
+	err = cfg.AddHashedMarker(w, req, "pw_epoch", "1700000000")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//raw value should not be stored
+	stored, _ := cfg.GetValue(req, "pw_epoch")
+	if stored == "1700000000" {
+		t.Fatal("raw value stored instead of hash")
+		return
+	}
+
+	match, err := cfg.VerifyMarker(req, "pw_epoch", "1700000000")
+	if err != nil || !match {
+		t.Fatal("marker should have matched", err)
+		return
+	}
+
+	match, err = cfg.VerifyMarker(req, "pw_epoch", "1800000000")
+	if err != nil || match {
+		t.Fatal("marker should not have matched", err)
+		return
+	}
+}
+
+func TestVerifyCode(t *testing.T) {
+	cfg := NewConfig()
+	cfg.CodeAttempts = 2
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	now := time.Now()
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	_, err = cfg.VerifyCode(w, req, "otp", "123456")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+
+	err = cfg.StoreCodeHash(w, req, "otp", "123456")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//wrong code uses an attempt
+	ok, err := cfg.VerifyCode(w, req, "otp", "000000")
+	if err != nil || ok {
+		t.Fatal("code should not have matched", err)
+		return
+	}
+
+	//correct code matches and is removed
+	ok, err = cfg.VerifyCode(w, req, "otp", "123456")
+	if err != nil || !ok {
+		t.Fatal("code should have matched", err)
+		return
+	}
+	_, err = cfg.VerifyCode(w, req, "otp", "123456")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+
+	//code is removed after running out of attempts
+	err = cfg.StoreCodeHash(w, req, "otp", "123456")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	for i := 0; i < 2; i++ {
+		ok, err = cfg.VerifyCode(w, req, "otp", "000000")
+		if err != nil || ok {
+			t.Fatal("code should not have matched", err)
+			return
+		}
+	}
+	_, err = cfg.VerifyCode(w, req, "otp", "123456")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+
+	//expired code
+	err = cfg.StoreCodeHash(w, req, "otp", "123456")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	now = now.Add(defaultCodeLifetime)
+	_, err = cfg.VerifyCode(w, req, "otp", "123456")
+	if err != ErrCodeExpired {
+		t.Fatal("ErrCodeExpired should have occured but didn't", err)
+		return
+	}
+}
+
+func TestEncodedSize(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", strings.Repeat("a", 100))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	size, err := cfg.EncodedSize(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	encoded, _ := cfg.ExtractCookie(w)
+	if size != len(encoded) {
+		t.Fatal("size does not match cookie", size, len(encoded))
+		return
+	}
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SkipUnchanged = true
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("cookie should have been set for changed session", err)
+		return
+	}
+
+	//setting the same value shouldn't write the cookie
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	w = httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if _, err := cfg.ExtractCookie(w); err != ErrNoCookie {
+		t.Fatal("cookie should not have been set for unchanged session")
+		return
+	}
+
+	//extending always writes the cookie
+	w = httptest.NewRecorder()
+	err = cfg.Extend(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if _, err := cfg.ExtractCookie(w); err != nil {
+		t.Fatal("cookie should have been set when extending", err)
+		return
+	}
+}
+
+func TestGetValidToken(t *testing.T) {
+	now := time.Now()
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddTokenWithExpiry(w, req, "token", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	token, err := cfg.GetValidToken(req)
+	if err != nil || token != "token" {
+		t.Fatal("token should have been valid", err)
+		return
+	}
+
+	now = now.Add(2 * time.Hour)
+	_, err = cfg.GetValidToken(req)
+	if err != ErrTokenExpired {
+		t.Fatal("ErrTokenExpired should have occured but didn't", err)
+		return
+	}
+}
+
+func TestAddTokenClearsExpiry(t *testing.T) {
+	now := time.Now()
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	cfg := TestConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddTokenWithExpiry(w, req, "token", now.Add(time.Minute))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w = httptest.NewRecorder()
+	err = cfg.AddToken(w, req, "new-long-lived")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == cfg.CookieName && cookie.MaxAge != int(cfg.MaxAge.Seconds()) {
+			t.Fatal("cookie should have used MaxAge", cookie.MaxAge)
+			return
+		}
+	}
+
+	now = now.Add(time.Hour)
+	token, err := cfg.GetValidToken(req)
+	if err != nil || token != "new-long-lived" {
+		t.Fatal("token should have been valid", token, err)
+		return
+	}
+
+	//rotating the token also clears the expiry
+	err = cfg.AddTokenWithExpiry(w, req, "token", now.Add(time.Minute))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	_, err = cfg.RotateToken(w, req, "rotated")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	now = now.Add(time.Hour)
+	token, err = cfg.GetValidToken(req)
+	if err != nil || token != "rotated" {
+		t.Fatal("token should have been valid", token, err)
+		return
+	}
+}
+
+func TestIDGenerator(t *testing.T) {
+	cfg := NewConfig()
+	cfg.IDGenerator = func() string {
+		return "01ARZ3NDEKTSV4RRFFQ69G5FAV"
+	}
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	id, err := cfg.SessionIdentifier(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if id != "01ARZ3NDEKTSV4RRFFQ69G5FAV" {
+		t.Fatal("ID not generated with IDGenerator", id)
+		return
+	}
+
+	//the identifier does not interfere with the integer session ID
+	_, err = cfg.GetSessionID(req)
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+	err = cfg.AddSessionID(w, req, 25)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	sid, err := cfg.GetSessionID(req)
+	if err != nil || sid != 25 {
+		t.Fatal("session ID not returned", sid, err)
+		return
+	}
+
+	//new sessions are saved with the generated identifier
+	w = httptest.NewRecorder()
+	s, err := cfg.GetSessionW(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil || !s.IsNew {
+		t.Fatal("new session should have been returned", err)
+		return
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	id, err = cfg.SessionIdentifier(httptest.NewRecorder(), req)
+	if err != nil || id != "01ARZ3NDEKTSV4RRFFQ69G5FAV" {
+		t.Fatal("generated identifier should have been saved", id, err)
+		return
+	}
+}
+
+func TestReissueOptions(t *testing.T) {
+	cfg := TestConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.ReissueOptions(w, req)
+	if err != ErrNoSession {
+		t.Fatal("ErrNoSession should have occured but didn't", err)
+		return
+	}
+
+	cfg.AddValue(w, req, "key", "value")
+	encoded, _ := cfg.ExtractCookie(w)
+
+	//promote to https
+	cfg2 := TestConfig()
+	cfg2.Secure = true
+	err = cfg2.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg2.AttachCookie(req, encoded)
+	w = httptest.NewRecorder()
+	err = cfg2.ReissueOptions(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].Secure {
+		t.Fatal("cookie not reissued with new options")
+		return
+	}
+}
+
+func TestSignString(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	signed, err := cfg.SignString("download:1234")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	s, err := cfg.VerifyString(signed)
+	if err != nil || s != "download:1234" {
+		t.Fatal("signed string not verified", err, s)
+		return
+	}
+
+	_, err = cfg.VerifyString(signed + "tampered")
+	if err == nil {
+		t.Fatal("Error should have occured but didn't")
+		return
+	}
+
+	//a different auth key should fail verification
+	other := NewConfig()
+	other.Init()
+	_, err = other.VerifyString(signed)
+	if err == nil {
+		t.Fatal("Error should have occured but didn't")
+		return
+	}
+}
+
+func TestReservedKeys(t *testing.T) {
+	keys := ReservedKeys()
+	found := false
+	for _, k := range keys {
+		if k == keyCreatedAt {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("created at should be a reserved key", keys)
+		return
+	}
+
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, keyCreatedAt, "value")
+	if err != ErrReservedKey {
+		t.Fatal("ErrReservedKey should have occured but didn't", err)
+		return
+	}
+
+	err = cfg.AddValue(w, req, ReservedKeyPrefixes()[0]+"key", "value")
+	if err != ErrReservedKey {
+		t.Fatal("ErrReservedKey should have occured but didn't", err)
+		return
+	}
+
+	err = cfg.AddMap(w, req, keyCreatedAt, map[string]string{"a": "1"})
+	if err != ErrReservedKey {
+		t.Fatal("ErrReservedKey should have occured but didn't", err)
+		return
+	}
+
+	//generic names are not reserved
+	err = cfg.AddValue(w, req, "created_at", "yesterday")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	kv, err := cfg.GetAllValues(req)
+	if err != nil || kv["created_at"] != "yesterday" {
+		t.Fatal("user value should have been returned", kv, err)
+		return
+	}
+}
+
+func TestSaveWithSameSite(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("POST", "/sso/callback", nil)
+	w := httptest.NewRecorder()
+	err = cfg.SaveWithSameSite(w, req, http.SameSiteNoneMode)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].SameSite != http.SameSiteNoneMode || !cookies[0].Secure {
+		t.Fatal("SameSite not overridden correctly")
+		return
+	}
+
+	//config should not be changed
+	if cfg.SameSite != defaultSameSite {
+		t.Fatal("config SameSite should not have changed")
+		return
+	}
+}
+
+func TestInspect(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	info, err := cfg.Inspect(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if info.Values["key"] != "value" || len(info.Values) != 1 {
+		t.Fatal("values not returned correctly", info.Values)
+		return
+	}
+	if !info.IsNew || info.CookieName != cfg.CookieName {
+		t.Fatal("metadata not returned correctly")
+		return
+	}
+	if info.Lifetime != cfg.MaxAge {
+		t.Fatal("lifetime not returned correctly", info.Lifetime)
+		return
+	}
+	if info.CreatedAt.IsZero() {
+		t.Fatal("created at not returned")
+		return
+	}
+}
+
+func TestAudience(t *testing.T) {
+	serviceA := TestConfig()
+	serviceA.Audience = "a"
+	serviceB := TestConfig()
+	serviceB.Audience = "b"
+	if err := serviceA.Init(); err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if err := serviceB.Init(); err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err := serviceA.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, _ := serviceA.ExtractCookie(w)
+
+	//same service accepts the cookie
+	req := httptest.NewRequest("GET", "/", nil)
+	serviceA.AttachCookie(req, encoded)
+	_, err = serviceA.GetValue(req, "key")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//other service rejects the cookie
+	req = httptest.NewRequest("GET", "/", nil)
+	serviceB.AttachCookie(req, encoded)
+	_, err = serviceB.GetValue(req, "key")
+	if err != ErrWrongAudience {
+		t.Fatal("ErrWrongAudience should have occured but didn't", err)
+		return
+	}
+}
+
+func TestAudienceFallback(t *testing.T) {
+	serviceA := TestConfig()
+	serviceA.Audience = "a"
+	serviceA.CookieName = "svcA"
+	serviceB := TestConfig()
+	serviceB.Audience = "b"
+	serviceB.CookieName = "svcB"
+	serviceB.FallbackCookieNames = []string{"svcA"}
+	if err := serviceA.Init(); err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if err := serviceB.Init(); err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err := serviceA.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, _ := serviceA.ExtractCookie(w)
+
+	//the other service rejects the cookie when read under a fallback name
+	req := httptest.NewRequest("GET", "/", nil)
+	serviceA.AttachCookie(req, encoded)
+	_, err = serviceB.GetValue(req, "key")
+	if err != ErrWrongAudience {
+		t.Fatal("ErrWrongAudience should have occured but didn't", err)
+		return
+	}
+
+	//the rejected cookie can still be expired
+	w = httptest.NewRecorder()
+	err = serviceB.Destroy(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	expired := false
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "svcA" && cookie.MaxAge < 0 {
+			expired = true
+		}
+	}
+	if !expired {
+		t.Fatal("fallback cookie should have been expired", w.Result().Cookies())
+		return
+	}
+}
+
+func TestNormalizeKeys(t *testing.T) {
+	cfg := NewConfig()
+	cfg.NormalizeKeys = true
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "Theme", "dark")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	v, err := cfg.GetValue(req, "THEME")
+	if err != nil || v != "dark" {
+		t.Fatal("key not normalized", err)
+		return
+	}
+}
+
+func TestGetValueFold(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "Token", "abc")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	_, err = cfg.GetValue(req, "token")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+
+	v, err := cfg.GetValueFold(req, "token")
+	if err != nil || v != "abc" {
+		t.Fatal("folded lookup failed", err)
+		return
+	}
+
+	_, err = cfg.GetValueFold(req, "missing")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+}
+
+func TestClose(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	err = cfg.Close()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+}
+
+func TestGetValueW(t *testing.T) {
+	cfg := NewConfig()
+	cfg.AutoExtend = true
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	w = httptest.NewRecorder()
+	v, err := cfg.GetValueW(w, req, "key")
+	if err != nil || v != "value" {
+		t.Fatal("value not retrieved", v, err)
+		return
+	}
+	if len(w.Result().Cookies()) == 0 {
+		t.Fatal("session should have been extended")
+		return
+	}
+
+	//disabled, nothing written
+	cfg.AutoExtend = false
+	w = httptest.NewRecorder()
+	_, err = cfg.GetValueW(w, req, "key")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Fatal("session should not have been extended")
+		return
+	}
+}
+
+func TestEqual(t *testing.T) {
+	running := NewConfig()
+	err := running.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//generated keys and defaults should be ignored
+	reloaded := NewConfig()
+	if !running.Equal(reloaded) {
+		t.Fatal("configs should be equal")
+		return
+	}
+
+	reloaded.Secure = true
+	if running.Equal(reloaded) {
+		t.Fatal("configs should not be equal")
+		return
+	}
+
+	reloaded = NewConfig()
+	reloaded.AuthKey = testAuthKey
+	if running.Equal(reloaded) {
+		t.Fatal("configs with different keys should not be equal")
+		return
+	}
+}
+
+func TestEqualAllFields(t *testing.T) {
+	//fields that hold state set by Init rather than settings
+	ignored := map[string]bool{
+		"store":               true,
+		"versions":            true,
+		"generatedAuthKey":    true,
+		"generatedEncryptKey": true,
+		"sealed":              true,
+	}
+
+	fields := reflect.TypeOf(Config{})
+	for i := 0; i < fields.NumField(); i++ {
+		name := fields.Field(i).Name
+		if ignored[name] {
+			continue
+		}
+
+		changed := NewConfig()
+		f := reflect.ValueOf(changed).Elem().Field(i)
+		f = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
+
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(f.String() + "changed")
+		case reflect.Bool:
+			f.SetBool(!f.Bool())
+		case reflect.Int, reflect.Int64:
+			if f.Type() == reflect.TypeOf(time.Duration(0)) {
+				f.SetInt(f.Int() + int64(time.Second))
+			} else {
+				f.SetInt(f.Int() + 1)
+			}
+		case reflect.Slice:
+			f.Set(reflect.Append(f, reflect.New(f.Type().Elem()).Elem()))
+		case reflect.Map:
+			f.Set(reflect.MakeMap(f.Type()))
+			f.SetMapIndex(reflect.ValueOf("key"), reflect.ValueOf("value"))
+		case reflect.Func:
+			f.Set(reflect.MakeFunc(f.Type(), func(args []reflect.Value) []reflect.Value {
+				return nil
+			}))
+		case reflect.Interface:
+			f.Set(reflect.ValueOf(&memoryOverflow{}))
+		default:
+			t.Fatal("no test value for field, add one or ignore the field", name, f.Kind())
+			return
+		}
+
+		if NewConfig().Equal(changed) {
+			t.Fatal("configs should not be equal when field differs, add it to Equal", name)
+			return
+		}
+	}
+}
+
+func TestDeleteValuesByPrefix(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	for k, v := range map[string]string{"cart.item1": "a", "cart.item2": "b", "profile.name": "c"} {
+		err = cfg.AddValue(w, req, k, v)
+		if err != nil {
+			t.Fatal("Error occured but should not have", err)
+			return
+		}
+	}
+
+	count, err := cfg.CountValuesNS(req, "cart.")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if count != 2 {
+		t.Fatal("wrong number of keys counted", count)
+		return
+	}
+
+	deleted, err := cfg.DeleteValuesByPrefix(w, req, "cart.")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if deleted != 2 {
+		t.Fatal("wrong number of keys deleted", deleted)
+		return
+	}
+
+	kv, err := cfg.GetAllValues(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(kv) != 1 || kv["profile.name"] != "c" {
+		t.Fatal("wrong keys remain", kv)
+		return
+	}
+}
+
+func TestSecureHeadersMiddleware(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	handler := cfg.SecureHeadersMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	//no session
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Header().Get("Vary") != "Cookie" {
+		t.Fatal("Vary header not set")
+		return
+	}
+	if w.Header().Get("Cache-Control") != "" {
+		t.Fatal("Cache-Control should not be set without a session")
+		return
+	}
+
+	//existing session
+	w = httptest.NewRecorder()
+	err = cfg.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Header().Get("Cache-Control") != "private" {
+		t.Fatal("Cache-Control not set for session", w.Header().Get("Cache-Control"))
+		return
+	}
+}
+
+func TestSecureHeadersMiddlewareFlushHijack(t *testing.T) {
+	cfg := TestConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	var hijackErr error
+	handler := cfg.SecureHeadersMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		_, _, hijackErr = w.(http.Hijacker).Hijack()
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if !w.Flushed {
+		t.Fatal("response should have been flushed")
+		return
+	}
+	if w.Header().Get("Cache-Control") != "private" {
+		t.Fatal("Cache-Control not set before flushing", w.Header().Get("Cache-Control"))
+		return
+	}
+	if !errors.Is(hijackErr, http.ErrNotSupported) {
+		t.Fatal("ErrNotSupported should have occured but didn't", hijackErr)
+		return
+	}
+}
+
+func TestSecureHeadersMiddlewareStatus(t *testing.T) {
+	cfg := TestConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//the handler doesn't write a response, the caller writes the status
+	inner := cfg.SecureHeadersMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+	}))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner.ServeHTTP(w, r)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatal("status should have been written by the caller", w.Code)
+		return
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatal("Cache-Control set by the handler should have been kept", w.Header().Get("Cache-Control"))
+		return
+	}
+}
+
+func TestAddGetValueJSONRaw(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	in := []byte(`{"z":1,"a":0.10000000000000000001}`)
+	err = cfg.AddValueJSONRaw(w, req, "blob", in)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	out, err := cfg.GetValueJSONRaw(req, "blob")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if string(out) != string(in) {
+		t.Fatal("json not returned untouched", string(out))
+		return
+	}
+
+	err = cfg.AddValueJSONRaw(w, req, "bad", []byte(`{"a":`))
+	if err != ErrInvalidJSON {
+		t.Fatal("ErrInvalidJSON should have occured but didn't", err)
+		return
+	}
+
+	_, err = cfg.GetValueJSONRaw(req, "missing")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+}
+
+func TestRotateSessionIDIfOlderThan(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	now := time.Now()
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	id, err := cfg.SessionIdentifier(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//not old enough
+	rotated, err := cfg.RotateSessionIDIfOlderThan(w, req, time.Hour)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if rotated {
+		t.Fatal("session ID should not have been rotated")
+		return
+	}
+
+	now = now.Add(2 * time.Hour)
+	rotated, err = cfg.RotateSessionIDIfOlderThan(w, req, time.Hour)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if !rotated {
+		t.Fatal("session ID should have been rotated")
+		return
+	}
+
+	newID, err := cfg.SessionIdentifier(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if newID == id {
+		t.Fatal("session ID not changed")
+		return
+	}
+
+	v, err := cfg.GetValue(req, "key")
+	if err != nil || v != "value" {
+		t.Fatal("other values should be preserved", err)
+		return
+	}
+
+	//rotation time is reset
+	rotated, err = cfg.RotateSessionIDIfOlderThan(w, req, time.Hour)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if rotated {
+		t.Fatal("session ID should not have been rotated again")
+		return
+	}
+}
+
+func TestGetSessionFromCookieString(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	s, err := cfg.GetSessionFromCookieString(encoded)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if s.IsNew || s.Values["key"] != "value" {
+		t.Fatal("session not decoded", s.Values)
+		return
+	}
+
+	_, err = cfg.GetSessionFromCookieString("garbage")
+	if err == nil {
+		t.Fatal("Error should have occured but didn't")
+		return
+	}
+}
+
+func TestGetSessionFromCookieStringChecks(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	cfg := TestConfig()
+	cfg.IdleTimeout = 10 * time.Minute
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err = cfg.AddValueUntil(w, httptest.NewRequest("GET", "/", nil), "key", "value", now.Add(time.Minute))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//expired values are removed
+	now = now.Add(2 * time.Minute)
+	s, err := cfg.GetSessionFromCookieString(encoded)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if _, exists := s.Values["key"]; exists {
+		t.Fatal("expired value should have been removed", s.Values)
+		return
+	}
+
+	//timed out sessions are returned with ErrTimedOut
+	now = now.Add(time.Hour)
+	s, err = cfg.GetSessionFromCookieString(encoded)
+	if err != ErrTimedOut || s == nil {
+		t.Fatal("ErrTimedOut should have occured but didn't", err)
+		return
+	}
+}
+
+func TestNewSSOConfig(t *testing.T) {
+	cfg := NewSSOConfig("example.com", testAuthKey, testEncryptKey)
+	if cfg.Domain != ".example.com" || cfg.SameSite != http.SameSiteLaxMode || !cfg.Secure || !cfg.HTTPOnly {
+		t.Fatal("sso settings not set", cfg)
+		return
+	}
+
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	cfg = NewSSOConfig("example.com", testAuthKey, testEncryptKey)
+	cfg.SameSite = http.SameSiteStrictMode
+	err = cfg.Init()
+	if err != ErrInvalidSSOConfig {
+		t.Fatal("ErrInvalidSSOConfig should have occured but didn't", err)
+		return
+	}
+
+	cfg = NewSSOConfig("localhost", testAuthKey, testEncryptKey)
+	err = cfg.Init()
+	if err != ErrInvalidSSOConfig {
+		t.Fatal("ErrInvalidSSOConfig should have occured but didn't", err)
+		return
+	}
+}
+
+func TestWillWriteCookie(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SkipUnchanged = true
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	will, err := cfg.WillWriteCookie(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if will {
+		t.Fatal("unchanged session should not write a cookie")
+		return
+	}
+
+	s, err := cfg.GetSession(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	s.Values["key"] = "changed"
+
+	will, err = cfg.WillWriteCookie(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if !will {
+		t.Fatal("changed session should write a cookie")
+		return
+	}
+}
+
+func TestAddValueValidation(t *testing.T) {
+	cfg := NewConfig()
+	cfg.MaxValueBytes = 8
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "short")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	err = cfg.AddValue(w, req, "key", "much too long")
+	if err != ErrValueTooLarge {
+		t.Fatal("ErrValueTooLarge should have occured but didn't", err)
+		return
+	}
+
+	err = cfg.AddValue(w, req, "key", "\xff\xfe")
+	if err != ErrInvalidValue {
+		t.Fatal("ErrInvalidValue should have occured but didn't", err)
+		return
+	}
+}
+
+func TestMergeFrom(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	anonReq := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, anonReq, "cart", "anon-cart")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = cfg.AddValue(w, anonReq, "theme", "dark")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	anon, err := cfg.GetSession(anonReq)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	err = cfg.AddValue(w, req, "cart", "user-cart")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	err = cfg.MergeFrom(w, req, anon, false)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	kv, _ := cfg.GetAllValues(req)
+	if kv["cart"] != "user-cart" || kv["theme"] != "dark" {
+		t.Fatal("values not merged without overwrite", kv)
+		return
+	}
+
+	err = cfg.MergeFrom(w, req, anon, true)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	kv, _ = cfg.GetAllValues(req)
+	if kv["cart"] != "anon-cart" {
+		t.Fatal("values not merged with overwrite", kv)
+		return
+	}
+}
+
+func TestIncompatibleData(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//authentic cookie that doesn't decode into session values
+	encoded, err := securecookie.EncodeMulti(cfg.CookieName, "not session values", cfg.store.Codecs...)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	_, err = cfg.GetSession(req)
+	if err != ErrIncompatibleData {
+		t.Fatal("ErrIncompatibleData should have occured but didn't", err)
+		return
+	}
+
+	//tampered cookies are not incompatible data
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded+"x")
+	_, err = cfg.GetSession(req)
+	if err == nil || err == ErrIncompatibleData {
+		t.Fatal("tampered cookie should return a different error", err)
+		return
+	}
+
+	cfg.ResetIncompatibleData = true
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	s, err := cfg.GetSession(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if !s.IsNew || len(s.Values) != 0 {
+		t.Fatal("session should have been reset", s.Values)
+		return
+	}
+}
+
+func TestAutoSecure(t *testing.T) {
+	cfg := NewConfig()
+	cfg.AutoSecure = true
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//plain http
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, httptest.NewRequest("GET", "http://example.com/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if w.Result().Cookies()[0].Secure {
+		t.Fatal("cookie should not be secure over http")
+		return
+	}
+
+	//tls
+	w = httptest.NewRecorder()
+	err = cfg.AddValue(w, httptest.NewRequest("GET", "https://example.com/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if !w.Result().Cookies()[0].Secure {
+		t.Fatal("cookie should be secure over tls")
+		return
+	}
+
+	//behind a proxy
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w = httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if !w.Result().Cookies()[0].Secure {
+		t.Fatal("cookie should be secure behind https proxy")
+		return
+	}
+}
+
+func TestGetValueStrict(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	v, err := cfg.GetValueStrict(req, "key")
+	if err != nil || v != "value" {
+		t.Fatal("value not retrieved", err)
+		return
+	}
+	_, err = cfg.GetValueStrict(req, "missing")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+
+	//modify the cookie, flipping a character keeps it valid base64
+	b := []byte(encoded)
+	if b[10] == 'A' {
+		b[10] = 'B'
+	} else {
+		b[10] = 'A'
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, string(b))
+	_, err = cfg.GetValueStrict(req, "key")
+	if err != ErrTampered {
+		t.Fatal("ErrTampered should have occured but didn't", err)
+		return
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, "!!!not-base64")
+	_, err = cfg.GetValueStrict(req, "key")
+	if err != ErrTampered {
+		t.Fatal("ErrTampered should have occured but didn't", err)
+		return
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.SelfTest()
+	if err != ErrNotInitialized {
+		t.Fatal("ErrNotInitialized should have occured but didn't", err)
+		return
+	}
+
+	err = cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	err = cfg.SelfTest()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+}
+
+func TestReadWriteCookieName(t *testing.T) {
+	old := TestConfig()
+	old.CookieName = "old_session"
+	err := old.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err = old.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := old.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	cfg := TestConfig()
+	cfg.ReadCookieName = "old_session"
+	cfg.WriteCookieName = "new_session"
+	err = cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	old.AttachCookie(req, encoded)
+	v, err := cfg.GetValue(req, "key")
+	if err != nil || v != "value" {
+		t.Fatal("value not read from old cookie", err)
+		return
+	}
+
+	w = httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "other", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	var wroteNew, expiredOld bool
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "new_session" && c.MaxAge > 0 {
+			wroteNew = true
+		}
+		if c.Name == "old_session" && c.MaxAge < 0 {
+			expiredOld = true
+		}
+	}
+	if !wroteNew || !expiredOld {
+		t.Fatal("session not moved to new cookie", w.Result().Cookies())
+		return
+	}
+}
+
+func TestExportValues(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	for k, v := range map[string]string{"user_id": "1", "username": "alice", "token": "secret"} {
+		err = cfg.AddValue(w, req, k, v)
+		if err != nil {
+			t.Fatal("Error occured but should not have", err)
+			return
+		}
+	}
+
+	kv, err := cfg.ExportValues(req, "user_id", "token", "missing", keyCreatedAt)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(kv) != 1 || kv["user_id"] != "1" {
+		t.Fatal("wrong values exported", kv)
+		return
+	}
+}
+
+func TestRejectDowngrade(t *testing.T) {
+	cfg := TestConfig()
+	cfg.RejectDowngrade = true
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, httptest.NewRequest("GET", "https://example.com/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	cfg.AttachCookie(req, encoded)
+	_, err = cfg.GetSession(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req = httptest.NewRequest("GET", "http://example.com/", nil)
+	cfg.AttachCookie(req, encoded)
+	_, err = cfg.GetSession(req)
+	if err != ErrInsecureTransport {
+		t.Fatal("ErrInsecureTransport should have occured but didn't", err)
+		return
+	}
+
+	//the check also applies to a cookie read under a fallback name
+	renamed := TestConfig()
+	renamed.RejectDowngrade = true
+	renamed.CookieName = "renamed"
+	renamed.FallbackCookieNames = []string{cfg.CookieName}
+	err = renamed.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req = httptest.NewRequest("GET", "http://example.com/", nil)
+	cfg.AttachCookie(req, encoded)
+	_, err = renamed.GetSession(req)
+	if err != ErrInsecureTransport {
+		t.Fatal("ErrInsecureTransport should have occured but didn't", err)
+		return
+	}
+
+	w = httptest.NewRecorder()
+	err = renamed.Destroy(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	expired := false
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == cfg.CookieName && cookie.MaxAge < 0 {
+			expired = true
+		}
+	}
+	if !expired {
+		t.Fatal("fallback cookie should have been expired", w.Result().Cookies())
+		return
+	}
+}
+
+func TestGetValueAny(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "old_key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	v, found, err := cfg.GetValueAny(req, "new_key", "old_key")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if v != "value" || found != "old_key" {
+		t.Fatal("wrong value or key returned", v, found)
+		return
+	}
+
+	_, _, err = cfg.GetValueAny(req, "a", "b")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+}
+
+func TestHarden(t *testing.T) {
+	cfg := TestConfig()
+	cfg.Harden()
+	if !strings.HasPrefix(cfg.CookieName, "__Host-") || !cfg.Secure || cfg.SameSite != http.SameSiteStrictMode {
+		t.Fatal("hardened settings not set", cfg)
+		return
+	}
+
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//weakened
+	cfg = TestConfig()
+	cfg.Harden()
+	cfg.SameSite = http.SameSiteLaxMode
+	err = cfg.Init()
+	if err != ErrInvalidHardenedConfig {
+		t.Fatal("ErrInvalidHardenedConfig should have occured but didn't", err)
+		return
+	}
+
+	//no keys
+	cfg = NewConfig()
+	cfg.Harden()
+	err = cfg.Init()
+	if err != ErrMissingKey {
+		t.Fatal("ErrMissingKey should have occured but didn't", err)
+		return
+	}
+
+	//prefix requirements
+	cfg = TestConfig()
+	cfg.CookieName = "__Host-session"
+	cfg.Secure = true
+	cfg.Domain = "example.com"
+	err = cfg.Init()
+	if err != ErrInvalidCookiePrefix {
+		t.Fatal("ErrInvalidCookiePrefix should have occured but didn't", err)
+		return
+	}
+}
+
+func TestAddGetEnum(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	roles := []string{"admin", "editor", "viewer"}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddEnum(w, req, "role", "editor", roles)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	v, err := cfg.GetEnum(req, "role", roles)
+	if err != nil || v != "editor" {
+		t.Fatal("enum not retrieved", v, err)
+		return
+	}
+
+	err = cfg.AddEnum(w, req, "role", "owner", roles)
+	if err != ErrInvalidEnum {
+		t.Fatal("ErrInvalidEnum should have occured but didn't", err)
+		return
+	}
+
+	//value no longer allowed
+	_, err = cfg.GetEnum(req, "role", []string{"admin"})
+	if err != ErrInvalidEnum {
+		t.Fatal("ErrInvalidEnum should have occured but didn't", err)
+		return
+	}
+}
+
+func TestValueEncoderDecoder(t *testing.T) {
+	cfg := NewConfig()
+	cfg.ValueEncoder = func(key, value string) (string, error) {
+		return "enc:" + value, nil
+	}
+	cfg.ValueDecoder = func(key, value string) (string, error) {
+		return strings.TrimPrefix(value, "enc:"), nil
+	}
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	s, err := cfg.GetSession(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if s.Values["key"] != "enc:value" {
+		t.Fatal("value not encoded", s.Values["key"])
+		return
+	}
+
+	v, err := cfg.GetValue(req, "key")
+	if err != nil || v != "value" {
+		t.Fatal("value not decoded", v, err)
+		return
+	}
+
+	kv, err := cfg.GetValues(req, "key")
+	if err != nil || kv["key"] != "value" {
+		t.Fatal("values not decoded", kv, err)
+		return
+	}
+}
+
+func TestValueEncoderAllFuncs(t *testing.T) {
+	//base64 decoding fails on values that were not encoded, so any func that skips the
+	//hooks causes an error
+	cfg := NewConfig()
+	cfg.ValueEncoder = func(key, value string) (string, error) {
+		return base64.StdEncoding.EncodeToString([]byte(value)), nil
+	}
+	cfg.ValueDecoder = func(key, value string) (string, error) {
+		b, err := base64.StdEncoding.DecodeString(value)
+		return string(b), err
+	}
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	err = cfg.AddTokenWithExpiry(w, req, "tok", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	v, err := cfg.GetValidToken(req)
+	if err != nil || v != "tok" {
+		t.Fatal("token not decoded", v, err)
+		return
+	}
+	v, err = cfg.GetToken(req)
+	if err != nil || v != "tok" {
+		t.Fatal("token not decoded", v, err)
+		return
+	}
+
+	old, err := cfg.RotateToken(w, req, "tok2")
+	if err != nil || old != "tok" {
+		t.Fatal("old token not decoded", old, err)
+		return
+	}
+	v, err = cfg.GetToken(req)
+	if err != nil || v != "tok2" {
+		t.Fatal("rotated token not decoded", v, err)
+		return
+	}
+
+	err = cfg.AddValue(w, req, "plain", "plain")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	v, _, err = cfg.GetValueAny(req, "missing", "plain")
+	if err != nil || v != "plain" {
+		t.Fatal("GetValueAny value not decoded", v, err)
+		return
+	}
+	v, err = cfg.GetValueFold(req, "PLAIN")
+	if err != nil || v != "plain" {
+		t.Fatal("GetValueFold value not decoded", v, err)
+		return
+	}
+	kv, err := cfg.GetAllValues(req)
+	if err != nil || kv["plain"] != "plain" {
+		t.Fatal("GetAllValues values not decoded", kv, err)
+		return
+	}
+
+	type profile struct {
+		Name string `session:"name"`
+	}
+	err = cfg.AddStruct(w, req, profile{Name: "alice"})
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	v, err = cfg.GetValue(req, "name")
+	if err != nil || v != "alice" {
+		t.Fatal("struct field not encoded", v, err)
+		return
+	}
+	var p profile
+	err = cfg.GetStruct(req, &p)
+	if err != nil || p.Name != "alice" {
+		t.Fatal("struct field not decoded", p, err)
+		return
+	}
+
+	req, tx := cfg.WithSession(req)
+	err = tx.Set("cart", "3 items")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	v, err = tx.Get("cart")
+	if err != nil || v != "3 items" {
+		t.Fatal("transaction value not decoded", v, err)
+		return
+	}
+	v, err = cfg.GetValue(req, "cart")
+	if err != nil || v != "3 items" {
+		t.Fatal("transaction value not encoded", v, err)
+		return
+	}
+}
+
+func TestSwapValue(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	old, existed, err := cfg.SwapValue(w, req, "page", "/home")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if existed || old != "" {
+		t.Fatal("no previous value should exist", old)
+		return
+	}
+
+	old, existed, err = cfg.SwapValue(w, req, "page", "/cart")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if !existed || old != "/home" {
+		t.Fatal("wrong previous value", old)
+		return
+	}
+
+	v, err := cfg.GetValue(req, "page")
+	if err != nil || v != "/cart" {
+		t.Fatal("new value not stored", v, err)
+		return
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	cfg := NewConfig()
+	if len(cfg.Warnings()) != 0 {
+		t.Fatal("no warnings should be returned for default config", cfg.Warnings())
+		return
+	}
+
+	cfg.MaxAge = 2 * 365 * 24 * time.Hour
+	if len(cfg.Warnings()) != 1 {
+		t.Fatal("MaxAge warning should have been returned")
+		return
+	}
+}
+
+func TestActiveFeatures(t *testing.T) {
+	cfg := TestConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(cfg.ActiveFeatures()) != 0 {
+		t.Fatal("no features should be active for default config", cfg.ActiveFeatures())
+		return
+	}
+
+	cfg = NewConfig()
+	cfg.AutoExtend = true
+	cfg.CompressMinBytes = 1024
+	err = cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	features := strings.Join(cfg.ActiveFeatures(), " ")
+	if features != "GeneratedKeys CompressMinBytes=1024 AutoExtend" {
+		t.Fatal("unexpected features returned", features)
+		return
+	}
+}
+
+func TestKeysFromPassphrase(t *testing.T) {
+	a := NewConfig()
+	err := a.KeysFromPassphrase("correct horse battery staple", "my-app")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = a.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//same passphrase and salt decode each other's cookies
+	b := NewConfig()
+	err = b.KeysFromPassphrase("correct horse battery staple", "my-app")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = b.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err = a.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := a.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	b.AttachCookie(req, encoded)
+	v, err := b.GetValue(req, "key")
+	if err != nil || v != "value" {
+		t.Fatal("derived keys should match", err)
+		return
+	}
+
+	err = NewConfig().KeysFromPassphrase("", "my-app")
+	if err != ErrMissingKey {
+		t.Fatal("ErrMissingKey should have occured but didn't", err)
+		return
+	}
+}
+
+func TestValues(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	values, save, err := cfg.Values(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	values["a"] = "1"
+	values["b"] = "2"
+
+	w := httptest.NewRecorder()
+	err = save(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(w.Result().Cookies()) != 1 {
+		t.Fatal("session should have been saved once")
+		return
+	}
+
+	v, err := cfg.GetValue(req, "b")
+	if err != nil || v != "2" {
+		t.Fatal("value not stored", err)
+		return
+	}
+
+	//bookkeeping keys are not returned and cannot be set
+	values, save, err = cfg.Values(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if _, exists := values[keyCreatedAt]; exists {
+		t.Fatal("bookkeeping keys should not be returned", values)
+		return
+	}
+	delete(values, "a")
+	values[keyCreatedAt] = "0"
+	err = save(httptest.NewRecorder())
+	if err != ErrReservedKey {
+		t.Fatal("ErrReservedKey should have occured but didn't", err)
+		return
+	}
+
+	delete(values, keyCreatedAt)
+	err = save(httptest.NewRecorder())
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	_, err = cfg.GetValue(req, "a")
+	if err != ErrKeyNotFound {
+		t.Fatal("removed value should have been deleted", err)
+		return
+	}
+}
+
+func TestAddValueUntil(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	now := time.Now()
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	until := now.Add(time.Hour)
+	err = cfg.AddValueUntil(w, req, "promo", "SPRING", until)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = cfg.AddValueUntil(w, req, "banner", "spring.png", until)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	v, err := cfg.GetValue(req, "promo")
+	if err != nil || v != "SPRING" {
+		t.Fatal("value should exist before until", err)
+		return
+	}
+
+	now = now.Add(2 * time.Hour)
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	_, err = cfg.GetValue(req, "promo")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+	kv, err := cfg.GetAllValues(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(kv) != 1 || kv["key"] != "value" {
+		t.Fatal("expired values should have been removed", kv)
+		return
+	}
+}
+
+func TestAddValueUntilReplaced(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	now := time.Now()
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	err = cfg.AddValueUntil(w, req, "promo", "SPRING", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = cfg.AddValueUntil(w, req, "banner", "spring.png", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//values replaced without an until no longer expire
+	_, _, err = cfg.SwapValue(w, req, "promo", "SUMMER")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//values replaced with an until use the new until
+	err = cfg.AddValueUntil(w, req, "banner", "summer.png", now.Add(3*time.Hour))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	now = now.Add(2 * time.Hour)
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	v, err := cfg.GetValue(req, "promo")
+	if err != nil || v != "SUMMER" {
+		t.Fatal("swapped value should not expire", v, err)
+		return
+	}
+	v, err = cfg.GetValue(req, "banner")
+	if err != nil || v != "summer.png" {
+		t.Fatal("value should exist before the new until", v, err)
+		return
+	}
+}
+
+func TestRejectNewSessions(t *testing.T) {
+	issuer := TestConfig()
+	err := issuer.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	api := TestConfig()
+	api.RejectNewSessions = true
+	err = api.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	_, err = api.GetSession(httptest.NewRequest("GET", "/", nil))
+	if err != ErrNoSession {
+		t.Fatal("ErrNoSession should have occured but didn't", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err = issuer.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := issuer.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	api.AttachCookie(req, encoded)
+	v, err := api.GetValue(req, "key")
+	if err != nil || v != "value" {
+		t.Fatal("existing session should be returned", err)
+		return
+	}
+}
+
+func TestOnDecodeError(t *testing.T) {
+	var calls, length int
+	cfg := NewConfig()
+	cfg.OnDecodeError = func(r *http.Request, cookieLen int, err error) {
+		calls++
+		length = cookieLen
+	}
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//no cookie, not a decode error
+	_, err = cfg.GetSession(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if calls != 0 {
+		t.Fatal("OnDecodeError should not be called without a cookie")
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, "tampered")
+	_, err = cfg.GetSession(req)
+	if err == nil {
+		t.Fatal("Error should have occured but didn't")
+		return
+	}
+	if calls != 1 || length != len("tampered") {
+		t.Fatal("OnDecodeError not called correctly", calls, length)
+		return
+	}
+
+	//the cached error is only reported once per request
+	_, err = cfg.GetSession(req)
+	if err == nil {
+		t.Fatal("Error should have occured but didn't")
+		return
+	}
+	if calls != 1 {
+		t.Fatal("OnDecodeError should only be called once per request", calls)
+		return
+	}
+
+	//fallback cookies that can't be decoded are reported too
+	fallback := NewConfig()
+	fallback.FallbackCookieNames = []string{"old_session"}
+	fallback.OnDecodeError = cfg.OnDecodeError
+	err = fallback.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "old_session", Value: "tampered-old"})
+	for i := 0; i < 2; i++ {
+		_, err = fallback.GetSession(req)
+		if err != nil {
+			t.Fatal("Error occured but should not have", err)
+			return
+		}
+	}
+	if calls != 2 || length != len("tampered-old") {
+		t.Fatal("OnDecodeError not called correctly for the fallback cookie", calls, length)
+		return
+	}
+}
+
+func TestRegisterCompanionCookie(t *testing.T) {
+	cfg := NewConfig()
+	cfg.RegisterCompanionCookie("remember_me")
+	cfg.RegisterCompanionCookie("remember_me")
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(cfg.companions) != 1 {
+		t.Fatal("companion cookie registered more than once")
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "remember_me", Value: "1"})
+	req.AddCookie(&http.Cookie{Name: cfg.csrfCookieName(), Value: "token"})
+	req.AddCookie(&http.Cookie{Name: "unrelated", Value: "1"})
+
+	w := httptest.NewRecorder()
+	err = cfg.Destroy(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	expired := make(map[string]bool)
+	for _, c := range w.Result().Cookies() {
+		if c.MaxAge < 0 {
+			expired[c.Name] = true
+		}
+	}
+	if !expired[cfg.CookieName] || !expired["remember_me"] || !expired[cfg.csrfCookieName()] || expired["unrelated"] {
+		t.Fatal("wrong cookies expired", expired)
+		return
+	}
+}
+
+func TestValuesAsJSON(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	for k, v := range map[string]string{"theme": "dark", "token": "secret"} {
+		err = cfg.AddValue(w, req, k, v)
+		if err != nil {
+			t.Fatal("Error occured but should not have", err)
+			return
+		}
+	}
+
+	b, err := cfg.ValuesAsJSON(req, "theme", "token")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if string(b) != `{"theme":"dark"}` {
+		t.Fatal("wrong json returned", string(b))
+		return
+	}
+}
+
+func TestNew(t *testing.T) {
+	cfg, err := New(
+		WithKeys(testAuthKey, testEncryptKey),
+		WithMaxAge(24*time.Hour),
+		WithSecure(true),
+		WithSameSite(http.SameSiteLaxMode),
+		WithCookieName("app_session"),
+		WithDomain("example.com"),
+	)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if cfg.AuthKey != testAuthKey || cfg.MaxAge != 24*time.Hour || !cfg.Secure || cfg.SameSite != http.SameSiteLaxMode || cfg.CookieName != "app_session" || cfg.Domain != "example.com" {
+		t.Fatal("options not applied", cfg)
+		return
+	}
+	if cfg.store == nil {
+		t.Fatal("config should have been initialized")
+		return
+	}
+
+	_, err = New(WithMaxAge(0))
+	if err != ErrMaxAgeTooShort {
+		t.Fatal("ErrMaxAgeTooShort should have occured but didn't", err)
+		return
+	}
+}
+
+func TestSameSession(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//sessions with IDs, saved again between requests
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	_, err = cfg.SessionIdentifier(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	first, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w = httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	second, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	a := httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(a, first)
+	b := httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(b, second)
+	same, err := cfg.SameSession(a, b)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if !same {
+		t.Fatal("requests should have the same session")
+		return
+	}
+
+	//different session
+	w = httptest.NewRecorder()
+	_, err = cfg.SessionIdentifier(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	other, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	b = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(b, other)
+	same, err = cfg.SameSession(a, b)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if same {
+		t.Fatal("requests should not have the same session")
+		return
+	}
+
+	_, err = cfg.SameSession(a, httptest.NewRequest("GET", "/", nil))
+	if err != ErrNoCookie {
+		t.Fatal("ErrNoCookie should have occured but didn't", err)
+		return
+	}
+}
+
+func TestReturnURL(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	for _, bad := range []string{"https://evil.com", "//evil.com", "/\\evil.com", "evil.com", "/a\nb"} {
+		err = cfg.SetReturnURL(w, req, bad)
+		if err != ErrInvalidReturnURL {
+			t.Fatal("ErrInvalidReturnURL should have occured but didn't", bad, err)
+			return
+		}
+	}
+
+	err = cfg.SetReturnURL(w, req, "/account?tab=billing")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	u, err := cfg.PopReturnURL(w, req, "/")
+	if err != nil || u != "/account?tab=billing" {
+		t.Fatal("wrong return url", u, err)
+		return
+	}
+
+	//removed after pop
+	u, err = cfg.PopReturnURL(w, req, "/home")
+	if err != nil || u != "/home" {
+		t.Fatal("fallback should have been returned", u, err)
+		return
+	}
+}
+
+func TestGetSessionPreferring(t *testing.T) {
+	cfg := TestConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	encode := func(domain string) string {
+		w := httptest.NewRecorder()
+		err := cfg.AddValue(w, httptest.NewRequest("GET", "/", nil), "issued_for", domain)
+		if err != nil {
+			t.Fatal("Error occured but should not have", err)
+		}
+		encoded, err := cfg.ExtractCookie(w)
+		if err != nil {
+			t.Fatal("Error occured but should not have", err)
+		}
+		return encoded
+	}
+	hostOnly := encode("host")
+	domain := encode("domain")
+
+	preferDomain := func(s *sessions.Session) bool {
+		return s.Values["issued_for"] == "domain"
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, hostOnly)
+	cfg.AttachCookie(req, domain)
+	s, err := cfg.GetSessionPreferring(req, preferDomain)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if s.Values["issued_for"] != "domain" {
+		t.Fatal("preferred cookie should have been used", s.Values)
+		return
+	}
+
+	//later calls use the same cookie
+	v, err := cfg.GetValue(req, "issued_for")
+	if err != nil || v != "domain" {
+		t.Fatal("preferred cookie should have been used", v, err)
+		return
+	}
+	if len(req.Cookies()) != 1 {
+		t.Fatal("duplicate cookie should have been removed", req.Cookies())
+		return
+	}
+
+	//no match falls back to the first cookie
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, hostOnly)
+	cfg.AttachCookie(req, hostOnly)
+	s, err = cfg.GetSessionPreferring(req, preferDomain)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if s.Values["issued_for"] != "host" {
+		t.Fatal("first cookie should have been used", s.Values)
+		return
+	}
+}
+
+func TestValueEquals(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	_, err = cfg.ValueEquals(req, "token", "abc123")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+
+	err = cfg.AddValue(w, req, "token", "abc123")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	equal, err := cfg.ValueEquals(req, "token", "abc123")
+	if err != nil || !equal {
+		t.Fatal("values should have been equal", err)
+		return
+	}
+
+	equal, err = cfg.ValueEquals(req, "token", "abc124")
+	if err != nil || equal {
+		t.Fatal("values should not have been equal", err)
+		return
+	}
+}
+
+func TestHeadersSentMiddleware(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	var before, after error
+	h := HeadersSentMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		before = cfg.AddValue(w, r, "user_id", "2554")
+		w.Write([]byte("hello"))
+		after = cfg.AddValue(w, r, "user_id", "2555")
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if before != nil {
+		t.Fatal("Error occured but should not have", before)
+		return
+	}
+	if after != ErrHeadersAlreadySent {
+		t.Fatal("ErrHeadersAlreadySent should have occured but didn't", after)
+		return
+	}
+}
+
+func TestHeadersSentMiddlewareFlush(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	var after, hijackErr error
+	h := HeadersSentMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		after = cfg.AddValue(w, r, "user_id", "2555")
+		_, _, hijackErr = w.(http.Hijacker).Hijack()
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !w.Flushed {
+		t.Fatal("response should have been flushed")
+		return
+	}
+	if after != ErrHeadersAlreadySent {
+		t.Fatal("ErrHeadersAlreadySent should have occured but didn't", after)
+		return
+	}
+	if !errors.Is(hijackErr, http.ErrNotSupported) {
+		t.Fatal("ErrNotSupported should have occured but didn't", hijackErr)
+		return
+	}
+}
+
+func TestGetSessionInvalidCookieName(t *testing.T) {
+	cfg := &Config{MaxAge: time.Hour}
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	s, err := cfg.GetSession(httptest.NewRequest("GET", "/", nil))
+	if err == nil || s != nil {
+		t.Fatal("error should have occured for a blank cookie name", s, err)
+		return
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines helpers for writing tests against sessions, for simulating a request
+that carries a session cookie issued by a previous response.
+*/
+
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+)
+
+//ExtractCookie returns the encoded value of the session cookie set on a recorded response.
+//If the cookie was set more than once, the last value is returned. ErrNoCookie is returned
+//if the response did not set the session cookie.
+func (c *Config) ExtractCookie(w *httptest.ResponseRecorder) (encoded string, err error) {
+	found := false
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == c.CookieName {
+			encoded = cookie.Value
+			found = true
+		}
+	}
+
+	if !found {
+		return "", ErrNoCookie
+	}
+
+	return
+}
+
+//ExtractCookie returns the encoded session cookie using the default package level config.
+func ExtractCookie(w *httptest.ResponseRecorder) (encoded string, err error) {
+	return config.ExtractCookie(w)
+}
+
+//AttachCookie adds the encoded session cookie, typically retrieved with ExtractCookie, to
+//a request.
+func (c *Config) AttachCookie(r *http.Request, encoded string) {
+	r.AddCookie(&http.Cookie{
+		Name:  c.CookieName,
+		Value: encoded,
+	})
+}
+
+//AttachCookie adds the encoded session cookie to a request using the default package level config.
+func AttachCookie(r *http.Request, encoded string) {
+	config.AttachCookie(r, encoded)
+}
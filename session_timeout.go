@@ -0,0 +1,232 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines tooling for expiring sessions based on a user's inactivity and for
+reporting the time remaining until a session times out.
+*/
+
+package session
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+//keyLastActivity is the key in the session the time of the user's last request is stored
+//under. The time is stored as a unix timestamp.
+const keyLastActivity = keyPrefixInternal + "last_activity"
+
+//defaultInactivityStatus is the status code returned when a session has been inactive for
+//too long and no redirect is configured.
+const defaultInactivityStatus = http.StatusUnauthorized
+
+//InactivityGuard returns middleware that expires sessions that have been inactive for
+//longer than the idle duration, or the IdleTimeout if idle is 0. If neither is set, only the
+//AbsoluteTimeout is checked. On each request, the time of the previous request is read from
+//the session. If the idle duration, or the AbsoluteTimeout, has been exceeded, the session
+//is destroyed and the request is rejected, either by redirecting to InactivityRedirect or by
+//responding with InactivityStatus. Requests whose session cannot be used, for example since
+//the cookie was tampered with or was issued for a different Audience, are rejected the same
+//way after the cookie is expired. Otherwise, the activity time is updated for existing
+//sessions and the next handler is called. New sessions are not saved so anonymous visitors
+//are not given a cookie.
+func (c *Config) InactivityGuard(idle time.Duration) func(http.Handler) http.Handler {
+	if idle <= 0 {
+		idle = c.IdleTimeout
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s, err := c.GetSession(r)
+			if err == ErrTimedOut {
+				err = c.Destroy(w, r)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				c.rejectInactive(w, r)
+				return
+			}
+			if unusableSession(err) {
+				err = c.expireCookie(w, r)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				c.rejectInactive(w, r)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if s.IsNew {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			now := nowFunc()
+
+			if v, exists := s.Values[keyLastActivity].(string); exists && idle > 0 {
+				unix, err := strconv.ParseInt(v, 10, 64)
+				if err == nil && now.Sub(time.Unix(unix, 0)) > idle {
+					err = c.Destroy(w, r)
+					if err != nil {
+						http.Error(w, err.Error(), http.StatusInternalServerError)
+						return
+					}
+
+					c.rejectInactive(w, r)
+					return
+				}
+			}
+
+			s.Values[keyLastActivity] = strconv.FormatInt(now.Unix(), 10)
+			err = c.save(w, r, s)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+//InactivityGuard returns middleware that expires inactive sessions using the default package
+//level config.
+func InactivityGuard(idle time.Duration) func(http.Handler) http.Handler {
+	return config.InactivityGuard(idle)
+}
+
+//unusableSession returns true if GetSession returned an error because of the cookie the
+//request carried, or the lack of one, rather than because of a failure on the server.
+func unusableSession(err error) bool {
+	if rejected(err) || err == ErrNoSession || err == ErrIncompatibleData {
+		return true
+	}
+
+	var cookieErr securecookie.Error
+	return errors.As(err, &cookieErr) && cookieErr.IsDecode()
+}
+
+//expireCookie expires the session cookie the request carried without reading the session.
+//This is used when the session could not be read, since Destroy needs the session.
+func (c *Config) expireCookie(w http.ResponseWriter, r *http.Request) error {
+	s := sessions.NewSession(c.store, c.CookieName)
+	s.Options = c.getOptions()
+	s.Options.MaxAge = -1
+	return c.write(w, r, s, true)
+}
+
+//rejectInactive responds to a request whose session was expired due to inactivity.
+func (c *Config) rejectInactive(w http.ResponseWriter, r *http.Request) {
+	if c.InactivityRedirect != "" {
+		http.Redirect(w, r, c.InactivityRedirect, http.StatusSeeOther)
+		return
+	}
+
+	status := c.InactivityStatus
+	if status == 0 {
+		status = defaultInactivityStatus
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+//TimeoutStatus returns the time remaining until the session exceeds the IdleTimeout and the
+//AbsoluteTimeout, for example to show a user when they will be logged out. The idle time
+//is measured from the last request recorded by InactivityGuard, or from when the session
+//was created if no activity was recorded. A remaining time of 0 is returned if the timeout
+//is not set. ErrTimedOut is returned, along with the remaining times, if either timeout has
+//been exceeded. ErrNoSession is returned if the request did not have a session.
+func (c *Config) TimeoutStatus(r *http.Request) (idleRemaining, absoluteRemaining time.Duration, err error) {
+	s, err := c.GetSession(r)
+	if err != nil && err != ErrTimedOut {
+		return
+	}
+
+	if s.IsNew || unixValue(s, keyCreatedAt).IsZero() {
+		return 0, 0, ErrNoSession
+	}
+
+	return c.timeoutRemaining(s)
+}
+
+//TimeoutStatus returns the time remaining until the session exceeds the idle and absolute
+//timeouts using the default package level config.
+func TimeoutStatus(r *http.Request) (idleRemaining, absoluteRemaining time.Duration, err error) {
+	return config.TimeoutStatus(r)
+}
+
+//timeoutRemaining returns the time remaining until the session exceeds the IdleTimeout and
+//the AbsoluteTimeout. ErrTimedOut is returned if either timeout has been exceeded. Sessions
+//without a creation time, for example those issued before the creation time was stored,
+//never time out; use Normalize to stamp them.
+func (c *Config) timeoutRemaining(s *sessions.Session) (idleRemaining, absoluteRemaining time.Duration, err error) {
+	created := unixValue(s, keyCreatedAt)
+	if created.IsZero() {
+		return
+	}
+
+	lastActivity := unixValue(s, keyLastActivity)
+	if lastActivity.IsZero() {
+		lastActivity = created
+	}
+
+	now := nowFunc()
+	if c.IdleTimeout > 0 {
+		idleRemaining = c.IdleTimeout - now.Sub(lastActivity)
+		if idleRemaining <= 0 {
+			err = ErrTimedOut
+		}
+	}
+	if c.AbsoluteTimeout > 0 {
+		absoluteRemaining = c.AbsoluteTimeout - now.Sub(created)
+		if absoluteRemaining <= 0 {
+			err = ErrTimedOut
+		}
+	}
+
+	return
+}
+
+//Normalize fills in bookkeeping values missing from an existing session, which can happen
+//when a session was issued before a feature was enabled, and saves the session. A missing
+//creation time or last activity time is set to now. This keeps timeout funcs, such as
+//TimeoutStatus, from treating partially stamped sessions differently. ErrNoSession is
+//returned if the request did not have a session.
+func (c *Config) Normalize(w http.ResponseWriter, r *http.Request) (err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	if s.IsNew {
+		return ErrNoSession
+	}
+
+	now := strconv.FormatInt(nowFunc().Unix(), 10)
+	for _, k := range []string{keyCreatedAt, keyLastActivity} {
+		if _, exists := s.Values[k].(string); !exists {
+			s.Values[k] = now
+		}
+	}
+
+	err = c.save(w, r, s)
+	return
+}
+
+//Normalize fills in bookkeeping values missing from a session using the default package level
+//config.
+func Normalize(w http.ResponseWriter, r *http.Request) (err error) {
+	return config.Normalize(w, r)
+}
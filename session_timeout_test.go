@@ -0,0 +1,361 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+func TestInactivityGuard(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	called := false
+	h := cfg.InactivityGuard(time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+	//New session calls next handler without being saved.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !called {
+		t.Fatal("next handler not called")
+		return
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Fatal("new session should not have been saved", w.Result().Cookies())
+		return
+	}
+	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+	//Active session calls next handler and stamps activity.
+	req := sessionRequest(t, cfg)
+	called = false
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if !called {
+		t.Fatal("next handler not called")
+		return
+	}
+
+	s, _ := cfg.GetSession(req)
+	if _, exists := s.Values[keyLastActivity]; !exists {
+		t.Fatal("last activity not stamped")
+		return
+	}
+	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+	//Inactive session is rejected with the default status.
+	called = false
+	s.Values[keyLastActivity] = strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if called {
+		t.Fatal("next handler should not have been called")
+		return
+	}
+	if w.Code != http.StatusUnauthorized {
+		t.Fatal("incorrect status code returned", w.Code)
+		return
+	}
+	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+	//Test Start>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+	//Inactive session is redirected when configured.
+	cfg.InactivityRedirect = "/login"
+	s.Values[keyLastActivity] = strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login" {
+		t.Fatal("request not redirected", w.Code)
+		return
+	}
+	//Test End<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+}
+
+func TestInactivityGuardFakeClock(t *testing.T) {
+	now := time.Now()
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	called := 0
+	h := cfg.InactivityGuard(time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called++
+	}))
+
+	req := sessionRequest(t, cfg)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	//still within idle duration
+	now = now.Add(59 * time.Second)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	//idle duration exceeded since last request
+	now = now.Add(61 * time.Second)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if called != 2 || w.Code != http.StatusUnauthorized {
+		t.Fatal("idle timeout not enforced", called, w.Code)
+		return
+	}
+}
+
+func TestInactivityGuardUnusableSession(t *testing.T) {
+	now := time.Now()
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	cfg := TestConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	called := 0
+	h := cfg.InactivityGuard(0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called++
+	}))
+
+	//no idle duration or IdleTimeout disables the idle check
+	req := sessionRequest(t, cfg)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	now = now.Add(time.Hour)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if called != 2 {
+		t.Fatal("sessions should not have been expired without an idle duration", called)
+		return
+	}
+
+	//tampered cookie is expired and rejected rather than failing
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, "tampered")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if called != 2 || w.Code != http.StatusUnauthorized {
+		t.Fatal("tampered session should have been rejected", called, w.Code)
+		return
+	}
+	c := w.Result().Cookies()
+	if len(c) == 0 || c[0].MaxAge >= 0 {
+		t.Fatal("tampered cookie should have been expired", c)
+		return
+	}
+}
+
+//sessionRequest returns a request carrying an existing session.
+func sessionRequest(t *testing.T, cfg *Config) *http.Request {
+	w := httptest.NewRecorder()
+	err := cfg.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	return req
+}
+
+func TestTimeoutStatus(t *testing.T) {
+	cfg := NewConfig()
+	cfg.IdleTimeout = 10 * time.Minute
+	cfg.AbsoluteTimeout = time.Hour
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	now := time.Now()
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	_, _, err = cfg.TimeoutStatus(httptest.NewRequest("GET", "/", nil))
+	if err != ErrNoSession {
+		t.Fatal("ErrNoSession should have occured but didn't", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	now = now.Add(5 * time.Minute)
+	req := httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	idle, absolute, err := cfg.TimeoutStatus(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if idle > 5*time.Minute || idle < 4*time.Minute || absolute > 55*time.Minute || absolute < 54*time.Minute {
+		t.Fatal("wrong remaining times", idle, absolute)
+		return
+	}
+
+	now = now.Add(10 * time.Minute)
+	_, _, err = cfg.TimeoutStatus(req)
+	if err != ErrTimedOut {
+		t.Fatal("ErrTimedOut should have occured but didn't", err)
+		return
+	}
+}
+
+func TestTimeoutEnforced(t *testing.T) {
+	now := time.Now()
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	cfg := TestConfig()
+	cfg.IdleTimeout = 10 * time.Minute
+	cfg.AbsoluteTimeout = time.Hour
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//idle timeout exceeded
+	now = now.Add(11 * time.Minute)
+	req := httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	_, err = cfg.GetValue(req, "key")
+	if err != ErrTimedOut {
+		t.Fatal("ErrTimedOut should have occured but didn't", err)
+		return
+	}
+
+	w = httptest.NewRecorder()
+	err = cfg.Destroy(w, req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	c := w.Result().Cookies()
+	if len(c) == 0 || c[0].MaxAge >= 0 {
+		t.Fatal("timed out cookie should have been expired", c)
+		return
+	}
+
+	//guard uses the IdleTimeout and rejects the timed out session
+	called := false
+	h := cfg.InactivityGuard(0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if called || w.Code != http.StatusUnauthorized {
+		t.Fatal("timed out session should have been rejected", called, w.Code)
+		return
+	}
+
+	//absolute timeout exceeded even when active
+	now = time.Now()
+	cfg.IdleTimeout = 0
+	w = httptest.NewRecorder()
+	err = cfg.AddValue(w, httptest.NewRequest("GET", "/", nil), "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	encoded, err = cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	now = now.Add(2 * time.Hour)
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	_, err = cfg.GetSession(req)
+	if err != ErrTimedOut {
+		t.Fatal("ErrTimedOut should have occured but didn't", err)
+		return
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	err = cfg.Normalize(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if err != ErrNoSession {
+		t.Fatal("ErrNoSession should have occured but didn't", err)
+		return
+	}
+
+	//session issued without bookkeeping values
+	values := map[interface{}]interface{}{"key": "value"}
+	encoded, err := securecookie.EncodeMulti(cfg.CookieName, values, cfg.store.Codecs...)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+	err = cfg.Normalize(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	info, err := cfg.Inspect(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if info.CreatedAt.IsZero() || info.LastActivity.IsZero() {
+		t.Fatal("bookkeeping values not filled in", info)
+		return
+	}
+}
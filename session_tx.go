@@ -0,0 +1,135 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines a transaction type for batching changes to a session. WithSession
+decodes the session once and stores a SessionTx in the request's context so that handlers
+deep in a call chain can retrieve it with GetSessionTx and change values without each
+change writing a cookie. The top level handler then calls Commit once to write a single
+Set-Cookie header with all the changes.
+
+	r, tx := session.WithSession(r)
+	next.ServeHTTP(w, r) //handlers call session.GetSessionTx(r).Set(...)
+	err := tx.Commit(w)
+*/
+
+package session
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/sessions"
+)
+
+//txContextKey is the key a SessionTx is stored under in a request's context.
+type txContextKey struct{}
+
+//SessionTx batches changes to a session until Commit is called.
+type SessionTx struct {
+	c *Config
+	r *http.Request
+	s *sessions.Session
+
+	//err is the error returned when the session was retrieved, this is returned by each
+	//method so that callers don't need to check it when calling WithSession.
+	err error
+
+	mu sync.Mutex
+}
+
+//WithSession retrieves the session for the request and returns a copy of the request with
+//a SessionTx for the session stored in the request's context.
+func (c *Config) WithSession(r *http.Request) (*http.Request, *SessionTx) {
+	tx := &SessionTx{c: c}
+	tx.s, tx.err = c.GetSession(r)
+
+	r = r.WithContext(context.WithValue(r.Context(), txContextKey{}, tx))
+	tx.r = r
+	return r, tx
+}
+
+//WithSession retrieves the session and stores a SessionTx in the request's context using
+//the default package level config.
+func WithSession(r *http.Request) (*http.Request, *SessionTx) {
+	return config.WithSession(r)
+}
+
+//GetSessionTx returns the SessionTx stored in the request's context by WithSession. Nil is
+//returned if WithSession was not called.
+func GetSessionTx(r *http.Request) *SessionTx {
+	tx, _ := r.Context().Value(txContextKey{}).(*SessionTx)
+	return tx
+}
+
+//Set sets a value in the session with the same checks as AddValue. The change is not saved
+//until Commit is called, however values large enough to be stored in the Overflow store
+//are written to the store immediately.
+func (tx *SessionTx) Set(key, value string) (err error) {
+	if tx.err != nil {
+		return tx.err
+	}
+
+	key = tx.c.normalizeKey(key)
+	if isInternalKey(key) {
+		return ErrReservedKey
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	return tx.c.setValue(tx.s, key, value)
+}
+
+//Get retrieves a value from the session, including changes made with Set that have not been
+//committed yet. ErrKeyNotFound is returned if the key does not exist and ErrWrongType is
+//returned if the value stored isn't a string.
+func (tx *SessionTx) Get(key string) (value string, err error) {
+	if tx.err != nil {
+		return "", tx.err
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	value, exists, err := tx.c.lookupValue(tx.s, tx.c.normalizeKey(key))
+	if err != nil {
+		return
+	}
+	if !exists {
+		return "", ErrKeyNotFound
+	}
+
+	return
+}
+
+//Delete removes a value from the session. The change is not saved until Commit is called,
+//however values stored in the Overflow store are deleted from the store immediately.
+func (tx *SessionTx) Delete(key string) (err error) {
+	if tx.err != nil {
+		return tx.err
+	}
+
+	key = tx.c.normalizeKey(key)
+	if isInternalKey(key) {
+		return ErrReservedKey
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	return tx.c.removeValue(tx.s, key)
+}
+
+//Commit saves the session, writing all the changes made in one cookie.
+func (tx *SessionTx) Commit(w http.ResponseWriter) (err error) {
+	if tx.err != nil {
+		return tx.err
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	return tx.c.save(w, tx.r, tx.s)
+}
@@ -0,0 +1,79 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessionTx(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	deep := func(r *http.Request) error {
+		return GetSessionTx(r).Set("cart", "1")
+	}
+
+	req, tx := cfg.WithSession(httptest.NewRequest("GET", "/", nil))
+	err = tx.Set("user", "alice")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = deep(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = tx.Delete("user")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	err = tx.Set(keyCreatedAt, "1")
+	if err != ErrReservedKey {
+		t.Fatal("ErrReservedKey should have occured but didn't", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	err = tx.Commit(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(w.Result().Cookies()) != 1 {
+		t.Fatal("exactly one cookie should have been written")
+		return
+	}
+
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+
+	_, tx = cfg.WithSession(req)
+	v, err := tx.Get("cart")
+	if err != nil || v != "1" {
+		t.Fatal("committed value not found", err)
+		return
+	}
+	_, err = tx.Get("user")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+
+	if GetSessionTx(httptest.NewRequest("GET", "/", nil)) != nil {
+		t.Fatal("no tx should be returned without WithSession")
+		return
+	}
+}
@@ -9,8 +9,10 @@ sessions.
 package session
 
 import (
+	"encoding/base64"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 //We define some typical fields stored in sessions with some helper funcs for retrieving
@@ -20,8 +22,26 @@ const (
 	keyUserID    = "user_id"
 	keyToken     = "token"
 	keySessionID = "session_id"
+
+	//keyIdentifier stores the identifier returned by SessionIdentifier. This is separate from
+	//the session ID key since identifiers are strings while AddSessionID and GetSessionID
+	//use integers.
+	keyIdentifier = keyPrefixInternal + "id"
+
+	//sessionIdentifierLength is the number of random bytes used in a generated session ID.
+	sessionIdentifierLength = 16
+
+	//keyTokenExpiresAt stores the time the token expires as a unix timestamp.
+	keyTokenExpiresAt = keyPrefixInternal + "token_expires_at"
+
+	//keyIDIssuedAt stores the time the session ID was last rotated as a unix timestamp.
+	keyIDIssuedAt = keyPrefixInternal + "id_issued_at"
 )
 
+//authKeys are the typical fields that identify a logged in user. These are retained when
+//a session is reset using ResetToAuth().
+var authKeys = []string{keyUsername, keyUserID, keyToken}
+
 //AddUsername adds the username value to the session using the username key.
 func (c *Config) AddUsername(w http.ResponseWriter, r *http.Request, value string) error {
 	return c.AddValue(w, r, keyUsername, value)
@@ -76,10 +96,22 @@ func GetUserID(r *http.Request) (value int64, err error) {
 
 //----------------------------------------------------------------------------------------------
 
-//AddToken adds the token value to the session using the token key. We assume user IDs
-//are provided as integers.
-func (c *Config) AddToken(w http.ResponseWriter, r *http.Request, value string) error {
-	return c.AddValue(w, r, keyToken, value)
+//AddToken adds the token value to the session using the token key. Any expiration stored
+//for a previous token by AddTokenWithExpiry is removed.
+func (c *Config) AddToken(w http.ResponseWriter, r *http.Request, value string) (err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	err = c.setValue(s, keyToken, value)
+	if err != nil {
+		return
+	}
+	delete(s.Values, keyTokenExpiresAt)
+
+	err = c.save(w, r, s)
+	return
 }
 
 //AddToken adds the token value to the session using the token key and the default
@@ -98,6 +130,106 @@ func GetToken(r *http.Request) (value string, err error) {
 	return config.GetToken(r)
 }
 
+//AddTokenWithExpiry adds the token value to the session using the token key and sets
+//the session cookie to expire at the same time as the token. This is useful when the
+//token has its own expiration, such as a JWT, so that the cookie does not outlive the
+//token, or vice versa. The expiration is stored in the session and used each time the
+//session is saved, including by Extend.
+func (c *Config) AddTokenWithExpiry(w http.ResponseWriter, r *http.Request, token string, exp time.Time) (err error) {
+	if exp.Sub(nowFunc()) < 1*time.Second {
+		return ErrMaxAgeTooShort
+	}
+
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	err = c.setValue(s, keyToken, token)
+	if err != nil {
+		return
+	}
+	s.Values[keyTokenExpiresAt] = strconv.FormatInt(exp.Unix(), 10)
+
+	err = c.save(w, r, s)
+	return
+}
+
+//AddTokenWithExpiry adds the token value and expiration to the session using the default
+//package level config.
+func AddTokenWithExpiry(w http.ResponseWriter, r *http.Request, token string, exp time.Time) error {
+	return config.AddTokenWithExpiry(w, r, token, exp)
+}
+
+//GetValidToken looks up the token key from the session and checks that the token has not
+//expired, based on the expiration provided to AddTokenWithExpiry. ErrTokenExpired is
+//returned if the token has expired. If no expiration was stored, the token is returned.
+func (c *Config) GetValidToken(r *http.Request) (token string, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	token, exists, err := c.lookupValue(s, keyToken)
+	if err != nil {
+		return
+	}
+	if !exists {
+		return "", ErrKeyNotFound
+	}
+
+	if v, exists := s.Values[keyTokenExpiresAt].(string); exists {
+		unix, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return "", err
+		}
+
+		if !nowFunc().Before(time.Unix(unix, 0)) {
+			return "", ErrTokenExpired
+		}
+	}
+
+	return
+}
+
+//GetValidToken looks up an unexpired token from the session using the default package level config.
+func GetValidToken(r *http.Request) (token string, err error) {
+	return config.GetValidToken(r)
+}
+
+//RotateToken replaces the token value in the session with a new token and returns the
+//previous token. This is done using a single read and save of the session to support
+//rotating-token schemes. ErrKeyNotFound is returned if no token was previously stored. Any
+//expiration stored for the previous token by AddTokenWithExpiry is removed.
+func (c *Config) RotateToken(w http.ResponseWriter, r *http.Request, newToken string) (oldToken string, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	oldToken, exists, err := c.lookupValue(s, keyToken)
+	if err != nil {
+		return
+	}
+	if !exists {
+		return "", ErrKeyNotFound
+	}
+
+	err = c.setValue(s, keyToken, newToken)
+	if err != nil {
+		return
+	}
+	delete(s.Values, keyTokenExpiresAt)
+
+	err = c.save(w, r, s)
+	return
+}
+
+//RotateToken replaces the token value in the session using the default package level config.
+func RotateToken(w http.ResponseWriter, r *http.Request, newToken string) (oldToken string, err error) {
+	return config.RotateToken(w, r, newToken)
+}
+
 //----------------------------------------------------------------------------------------------
 
 //AddSessionID adds the session ID value to the session using the session ID key. We assume session IDs
@@ -128,3 +260,134 @@ func (c *Config) GetSessionID(r *http.Request) (value int64, err error) {
 func GetSessionID(r *http.Request) (value int64, err error) {
 	return config.GetSessionID(r)
 }
+
+//SessionIdentifier returns a stable identifier for the session, typically for anonymous
+//analytics or correlating logs. If an identifier is already stored, it is returned as-is.
+//Otherwise, an identifier is generated with the IDGenerator, or randomly if no IDGenerator
+//is set, stored, and the session is saved. The identifier is stored separately from the
+//integer session ID stored with AddSessionID.
+func (c *Config) SessionIdentifier(w http.ResponseWriter, r *http.Request) (id string, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	if id, exists := s.Values[keyIdentifier].(string); exists && id != "" {
+		return id, nil
+	}
+
+	id, err = c.newSessionIdentifier()
+	if err != nil {
+		return
+	}
+
+	s.Values[keyIdentifier] = id
+
+	err = c.save(w, r, s)
+	return
+}
+
+//newSessionIdentifier returns a new session ID using the IDGenerator if one is set,
+//otherwise a random identifier is generated.
+func (c *Config) newSessionIdentifier() (id string, err error) {
+	if c.IDGenerator != nil {
+		return c.IDGenerator(), nil
+	}
+
+	b, err := randomBytes(sessionIdentifierLength)
+	if err != nil {
+		return
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+//SessionIdentifier returns a stable identifier for the session using the default package
+//level config.
+func SessionIdentifier(w http.ResponseWriter, r *http.Request) (id string, err error) {
+	return config.SessionIdentifier(w, r)
+}
+
+//RotateSessionIDIfOlderThan replaces the session's identifier, see SessionIdentifier, with a
+//new one if the current identifier was issued more than d ago, keeping all other values,
+//and saves the session. This limits how long a single identifier can be used to track an
+//anonymous visitor. The identifier's age is measured from the last rotation or, if it was
+//never rotated, from when the session was created. New sessions are never rotated.
+func (c *Config) RotateSessionIDIfOlderThan(w http.ResponseWriter, r *http.Request, d time.Duration) (rotated bool, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	issued := unixValue(s, keyIDIssuedAt)
+	if issued.IsZero() {
+		issued = unixValue(s, keyCreatedAt)
+	}
+	if issued.IsZero() || nowFunc().Sub(issued) <= d {
+		return
+	}
+
+	id, err := c.newSessionIdentifier()
+	if err != nil {
+		return
+	}
+
+	s.Values[keyIdentifier] = id
+	s.Values[keyIDIssuedAt] = strconv.FormatInt(nowFunc().Unix(), 10)
+
+	err = c.save(w, r, s)
+	if err != nil {
+		return
+	}
+
+	return true, nil
+}
+
+//RotateSessionIDIfOlderThan replaces the session ID if it is older than d using the default
+//package level config.
+func RotateSessionIDIfOlderThan(w http.ResponseWriter, r *http.Request, d time.Duration) (rotated bool, err error) {
+	return config.RotateSessionIDIfOlderThan(w, r, d)
+}
+
+//----------------------------------------------------------------------------------------------
+
+//ResetToAuth clears all values from the session except the typical auth values (username,
+//user ID, and token). This is useful for dropping transient state, for example after a
+//checkout is completed, while keeping the user logged in. Values this package stores for
+//its own bookkeeping, such as the token's expiration and when the session was created,
+//are kept so that expirations and timeouts still apply.
+func (c *Config) ResetToAuth(w http.ResponseWriter, r *http.Request) (err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	keep := make(map[string]bool, len(authKeys))
+	for _, k := range authKeys {
+		keep[k] = true
+	}
+
+	for _, k := range userKeys(s) {
+		if keep[k] {
+			continue
+		}
+
+		err = c.removeValue(s, k)
+		if err != nil {
+			return
+		}
+	}
+	for k := range s.Values {
+		if _, ok := k.(string); !ok {
+			delete(s.Values, k)
+		}
+	}
+
+	err = c.save(w, r, s)
+	return
+}
+
+//ResetToAuth clears all non-auth values from the session using the default package level config.
+func ResetToAuth(w http.ResponseWriter, r *http.Request) (err error) {
+	return config.ResetToAuth(w, r)
+}
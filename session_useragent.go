@@ -0,0 +1,86 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines detection of user agents that mishandle SameSite=None cookies, used
+when SameSiteUACompat is set. Some older browsers reject, or treat as Strict, cookies
+with SameSite=None so the attribute is omitted for these browsers instead. The list of
+incompatible browsers is from https://www.chromium.org/updates/same-site/incompatible-clients.
+*/
+
+package session
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gorilla/sessions"
+)
+
+var (
+	//iOS 12, all browsers since they all use WebKit.
+	uaIOS12 = regexp.MustCompile(`\(iP.+; CPU .*OS 12[_\d]*.*\) AppleWebKit/`)
+
+	//macOS 10.14 Safari and embedded browsers.
+	uaMacOS1014     = regexp.MustCompile(`\(Macintosh;.*Mac OS X 10_14[_\d]*.*\) AppleWebKit/`)
+	uaSafari        = regexp.MustCompile(`Version/.* Safari/`)
+	uaChromeBased   = regexp.MustCompile(`Chrom(e|ium)`)
+	uaMacEmbedded   = regexp.MustCompile(`^Mozilla/[\.\d]+ \(Macintosh;.*Mac OS X [_\d]+\) AppleWebKit/[\.\d]+ \(KHTML, like Gecko\)$`)
+	uaChromeVersion = regexp.MustCompile(`Chrom[^ /]+/(\d+)[\.\d]* `)
+
+	//UC Browser before 12.13.2.
+	uaUCBrowser = regexp.MustCompile(`UCBrowser/(\d+)\.(\d+)\.(\d+)[\.\d]* `)
+)
+
+//sameSiteNoneIncompatible returns true if the user agent is known to mishandle cookies
+//with SameSite=None.
+func sameSiteNoneIncompatible(ua string) bool {
+	if uaIOS12.MatchString(ua) {
+		return true
+	}
+
+	if uaMacOS1014.MatchString(ua) {
+		if uaSafari.MatchString(ua) && !uaChromeBased.MatchString(ua) {
+			return true
+		}
+		if uaMacEmbedded.MatchString(ua) {
+			return true
+		}
+	}
+
+	//chrome 51 to 66 reject SameSite=None cookies
+	if m := uaChromeVersion.FindStringSubmatch(ua); m != nil {
+		if v, err := strconv.Atoi(m[1]); err == nil && v >= 51 && v <= 66 {
+			return true
+		}
+	}
+
+	if m := uaUCBrowser.FindStringSubmatch(ua); m != nil {
+		major, _ := strconv.Atoi(m[1])
+		minor, _ := strconv.Atoi(m[2])
+		build, _ := strconv.Atoi(m[3])
+		switch {
+		case major != 12:
+			return major < 12
+		case minor != 13:
+			return minor < 13
+		default:
+			return build < 2
+		}
+	}
+
+	return false
+}
+
+//applySameSiteCompat omits the SameSite attribute from the options if SameSiteUACompat is
+//set, SameSite=None is being used, and the request's user agent mishandles SameSite=None.
+func (c *Config) applySameSiteCompat(r *http.Request, opts *sessions.Options) {
+	if !c.SameSiteUACompat || opts.SameSite != http.SameSiteNoneMode {
+		return
+	}
+
+	if sameSiteNoneIncompatible(r.UserAgent()) {
+		opts.SameSite = http.SameSiteDefaultMode
+	}
+}
@@ -0,0 +1,67 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSameSiteNoneIncompatible(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want bool
+	}{
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 12_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.0 Mobile/15E148 Safari/604.1", true},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 13_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.0 Mobile/15E148 Safari/604.1", false},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_6) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.1.2 Safari/605.1.15", true},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.132 Safari/537.36", false},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/62.0.3202.94 Safari/537.36", true},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", false},
+		{"Mozilla/5.0 (Linux; U; Android 8.0.0; en-US) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/57.0.2987.108 UCBrowser/12.13.0.1207 Mobile Safari/537.36", true},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:120.0) Gecko/20100101 Firefox/120.0", false},
+	}
+
+	for _, tt := range tests {
+		if got := sameSiteNoneIncompatible(tt.ua); got != tt.want {
+			t.Fatal("wrong result for user agent", tt.ua, got)
+			return
+		}
+	}
+}
+
+func TestSameSiteUACompat(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SameSite = http.SameSiteNoneMode
+	cfg.Secure = true
+	cfg.SameSiteUACompat = true
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 12_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.0 Mobile/15E148 Safari/604.1")
+	w := httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if c := w.Result().Cookies()[0]; c.SameSite == http.SameSiteNoneMode {
+		t.Fatal("SameSite should have been omitted")
+		return
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if c := w.Result().Cookies()[0]; c.SameSite != http.SameSiteNoneMode {
+		t.Fatal("SameSite=None should have been set", c.SameSite)
+		return
+	}
+}
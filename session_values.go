@@ -0,0 +1,83 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines helper functions for storing values in sessions that are not simple
+strings. These values are stored in the session as their native type and encoded using
+gob, therefore each type must be registered with gob.
+*/
+
+package session
+
+import (
+	"encoding/gob"
+	"net/http"
+)
+
+func init() {
+	gob.Register(map[string]string{})
+}
+
+//AddMap adds a map of strings to the session under a single key. This is useful for
+//storing a small set of related values as one unit. ErrReservedKey is returned if the key
+//is used by this package for its own bookkeeping. Each value in the map must be valid, the
+//same as for AddValue. Any value previously stored under the key is replaced, including one
+//stored in the Overflow store.
+func (c *Config) AddMap(w http.ResponseWriter, r *http.Request, key string, m map[string]string) (err error) {
+	key = c.normalizeKey(key)
+	if isInternalKey(key) {
+		return ErrReservedKey
+	}
+
+	for _, v := range m {
+		err = c.validValue(v)
+		if err != nil {
+			return
+		}
+	}
+
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	err = c.removeValue(s, key)
+	if err != nil {
+		return
+	}
+	s.Values[key] = m
+
+	err = c.save(w, r, s)
+	return
+}
+
+//AddMap adds a map of strings to the session using the default package level config.
+func AddMap(w http.ResponseWriter, r *http.Request, key string, m map[string]string) error {
+	return config.AddMap(w, r, key, m)
+}
+
+//GetMap retrieves a map of strings stored in the session. ErrKeyNotFound is returned if
+//the key does not exist and ErrWrongType is returned if the value stored isn't a map.
+func (c *Config) GetMap(r *http.Request, key string) (m map[string]string, err error) {
+	s, err := c.GetSession(r)
+	if err != nil {
+		return
+	}
+
+	raw, exists := s.Values[c.normalizeKey(key)]
+	if !exists {
+		return nil, ErrKeyNotFound
+	}
+
+	m, ok := raw.(map[string]string)
+	if !ok {
+		return nil, ErrWrongType
+	}
+
+	return
+}
+
+//GetMap retrieves a map of strings stored in the session using the default package level config.
+func GetMap(r *http.Request, key string) (m map[string]string, err error) {
+	return config.GetMap(r, key)
+}
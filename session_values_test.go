@@ -0,0 +1,101 @@
+package session
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAddAndGetMap(t *testing.T) {
+	cfg := TestConfig()
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	m := map[string]string{"street": "123 Main St", "city": "Springfield"}
+	err = cfg.AddMap(w, req, "address", m)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	err = cfg.AddValue(w, req, "key", "value")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	//map must survive being encoded in the cookie
+	encoded, err := cfg.ExtractCookie(w)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	cfg.AttachCookie(req, encoded)
+
+	got, err := cfg.GetMap(req, "address")
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if got["city"] != "Springfield" {
+		t.Fatal("map not retrieved", got)
+		return
+	}
+
+	_, err = cfg.GetMap(req, "key")
+	if err != ErrWrongType {
+		t.Fatal("ErrWrongType should have occured but didn't", err)
+		return
+	}
+
+	_, err = cfg.GetMap(req, "missing")
+	if err != ErrKeyNotFound {
+		t.Fatal("ErrKeyNotFound should have occured but didn't", err)
+		return
+	}
+
+	//maps should be skipped by GetAllValues
+	values, err := cfg.GetAllValues(req)
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	if len(values) != 1 {
+		t.Fatal("incorrect values returned", values)
+		return
+	}
+}
+
+func TestAddMapMaxValueBytes(t *testing.T) {
+	cfg := TestConfig()
+	cfg.MaxValueBytes = 8
+	cfg.NormalizeKeys = true
+	err := cfg.Init()
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	err = cfg.AddMap(w, req, "address", map[string]string{"street": "123 Main St"})
+	if err != ErrValueTooLarge {
+		t.Fatal("ErrValueTooLarge should have occured but didn't", err)
+		return
+	}
+
+	err = cfg.AddMap(w, req, "Address", map[string]string{"city": "Paris"})
+	if err != nil {
+		t.Fatal("Error occured but should not have", err)
+		return
+	}
+	m, err := cfg.GetMap(req, "address")
+	if err != nil || m["city"] != "Paris" {
+		t.Fatal("map should have been stored under the normalized key", m, err)
+		return
+	}
+}
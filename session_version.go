@@ -0,0 +1,165 @@
+/*
+Package session handles managing user sessions. This provides some tooling around
+gorilla/sessions to simplify use.
+
+This file defines tooling for detecting lost updates when a session is modified by
+concurrent requests, for example from two browser tabs. Each save of a session increments
+a version stored in the session. The latest version issued for each session is tracked in
+memory so that a request carrying an older version of the session, which would overwrite
+changes made by another request, can be detected when it is saved.
+
+Since versions are tracked in memory, this only works when a single instance of your app
+is serving requests for a session. Tracked versions are removed when a session is destroyed.
+Sessions that are never destroyed, for example when a user simply stops visiting, are
+evicted once more than MaxTrackedVersions sessions are tracked, starting with the session
+saved least recently. A conflict for an evicted session is not detected.
+*/
+
+package session
+
+import (
+	"container/list"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/sessions"
+)
+
+const (
+	//keyVersion is the key in the session the version of the session is stored under.
+	keyVersion = keyPrefixInternal + "version"
+
+	//keyVersionID is the key in the session a random identifier for the session is stored
+	//under. This is used to track the latest version issued for the session.
+	keyVersionID = keyPrefixInternal + "version_id"
+
+	//versionIDLength is the number of random bytes used in a version ID.
+	versionIDLength = 16
+)
+
+//defaultMaxTrackedVersions is the number of sessions versions are tracked for when
+//MaxTrackedVersions is not set.
+const defaultMaxTrackedVersions = 10000
+
+//versionTracker stores the latest version issued for each session, evicting the session
+//saved least recently once more than limit sessions are tracked.
+type versionTracker struct {
+	mu     sync.Mutex
+	limit  int
+	latest map[string]*list.Element
+	order  *list.List
+}
+
+//trackedVersion is the value of each element in a versionTracker's order.
+type trackedVersion struct {
+	id      string
+	version int64
+}
+
+//newVersionTracker returns a versionTracker ready for use. The default limit is used if
+//limit is less than 1.
+func newVersionTracker(limit int) *versionTracker {
+	if limit < 1 {
+		limit = defaultMaxTrackedVersions
+	}
+
+	return &versionTracker{
+		limit:  limit,
+		latest: make(map[string]*list.Element),
+		order:  list.New(),
+	}
+}
+
+//get returns the latest version issued for a session.
+func (vt *versionTracker) get(id string) int64 {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+
+	e, exists := vt.latest[id]
+	if !exists {
+		return 0
+	}
+	return e.Value.(*trackedVersion).version
+}
+
+//set saves the latest version issued for a session, evicting the session saved least
+//recently if the limit is exceeded.
+func (vt *versionTracker) set(id string, version int64) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+
+	if e, exists := vt.latest[id]; exists {
+		e.Value.(*trackedVersion).version = version
+		vt.order.MoveToFront(e)
+		return
+	}
+
+	vt.latest[id] = vt.order.PushFront(&trackedVersion{id: id, version: version})
+	for vt.order.Len() > vt.limit {
+		oldest := vt.order.Back()
+		vt.order.Remove(oldest)
+		delete(vt.latest, oldest.Value.(*trackedVersion).id)
+	}
+}
+
+//remove stops tracking versions for a session.
+func (vt *versionTracker) remove(id string) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+
+	if e, exists := vt.latest[id]; exists {
+		vt.order.Remove(e)
+		delete(vt.latest, id)
+	}
+}
+
+//checkVersion handles checking if the session being saved is older than the latest version
+//issued for the session and, if so, calls the OnConflict hook. The session's version is
+//then incremented. This is only used when OnConflict is set.
+func (c *Config) checkVersion(r *http.Request, s *sessions.Session) (err error) {
+	id, _ := s.Values[keyVersionID].(string)
+	if id == "" {
+		b, err := randomBytes(versionIDLength)
+		if err != nil {
+			return err
+		}
+		id = base64.RawURLEncoding.EncodeToString(b)
+		s.Values[keyVersionID] = id
+	}
+
+	var loaded int64
+	if v, exists := s.Values[keyVersion].(string); exists {
+		loaded, _ = strconv.ParseInt(v, 10, 64)
+	}
+
+	latest := c.versions.get(id)
+	if loaded < latest {
+		err = c.OnConflict(r, s)
+		if err != nil {
+			return
+		}
+	}
+
+	next := loaded
+	if latest > next {
+		next = latest
+	}
+	next++
+
+	s.Values[keyVersion] = strconv.FormatInt(next, 10)
+	c.versions.set(id, next)
+	return
+}
+
+//forgetVersion stops tracking versions for a session. This is used when a session is destroyed.
+func (c *Config) forgetVersion(s *sessions.Session) {
+	if c.versions == nil {
+		return
+	}
+
+	if id, exists := s.Values[keyVersionID].(string); exists {
+		c.versions.remove(id)
+	}
+}